@@ -0,0 +1,166 @@
+package resample
+
+import (
+	"container/list"
+	"io"
+	"sync"
+)
+
+// DefaultFilterCacheLimit is the default memory limit of the filter cache in bytes.
+const DefaultFilterCacheLimit = 256 << 20
+
+// sharedFilters is a process-wide cache of filters shared by all Resamplers.
+var sharedFilters = newFilterCache(DefaultFilterCacheLimit)
+
+// SetFilterCacheLimit sets the memory limit of the process-wide filter cache in bytes.
+//
+// Filters built for embedded and Kaiser filter options are immutable,
+// so Resamplers with the same filter options and ratio of rates share them.
+// When the cache exceeds the limit, least recently used filters are evicted,
+// Resamplers that use them are not affected.
+// Zero limit disables the cache.
+func SetFilterCacheLimit(bytes int) {
+	sharedFilters.setLimit(bytes)
+}
+
+// WarmFilterCache builds a filter for given rates and options
+// and puts it into the filter cache, so later New calls with the same
+// rates and options do not spend time on it.
+//
+// Options are the same as in New.
+func WarmFilterCache(inRate, outRate int, options ...Option) error {
+	_, err := New(io.Discard, FormatFloat64, inRate, outRate, 1, options...)
+	return err
+}
+
+// filterKey identifies a filter in the cache.
+//
+// Filters depend on rates only through the window scaling and,
+// for FilterModeMemoized, the number of memoized offsets,
+// so e.g. all upsampling resamplers share the same quantized filter.
+type filterKey struct {
+	data     *byte
+	length   int
+	density  int
+	isScaled bool
+	beta     float64
+	rolloff  float64
+
+	scale   float64
+	offsets int // Used only by FilterModeMemoized
+	mode    FilterMode
+	phases  int // Used only by FilterModeQuantized
+}
+
+func newFilterKey(info filterInfo, inRate, outRate int, mode FilterMode, phases int) filterKey {
+	var data *byte
+	if len(info.data) > 0 {
+		data = &info.data[0]
+	}
+	offsets := 0
+	if mode == FilterModeMemoized {
+		offsets = outRate / gcd(inRate, outRate)
+	}
+	if mode != FilterModeQuantized {
+		phases = 0
+	}
+
+	return filterKey{
+		data:     data,
+		length:   info.length,
+		density:  info.density,
+		isScaled: info.isScaled,
+		beta:     info.beta,
+		rolloff:  info.rolloff,
+
+		scale:   info.scale(inRate, outRate),
+		offsets: offsets,
+		mode:    mode,
+		phases:  phases,
+	}
+}
+
+type cacheEntry struct {
+	key  filterKey
+	once sync.Once
+	f    *filter
+	err  error
+	size int
+	elem *list.Element
+}
+
+// filterCache is an LRU cache of filters limited by their total size.
+//
+// Each filter is built once, concurrent requests for the same filter wait for it.
+type filterCache struct {
+	mu      sync.Mutex
+	limit   int
+	size    int
+	entries map[filterKey]*cacheEntry
+	lru     list.List // Entries from the most to the least recently used
+}
+
+func newFilterCache(limit int) *filterCache {
+	return &filterCache{
+		limit:   limit,
+		entries: make(map[filterKey]*cacheEntry),
+	}
+}
+
+// get returns a cached filter for given parameters or builds it.
+func (c *filterCache) get(info filterInfo, inRate, outRate int, mode FilterMode, phases int) (*filter, error) {
+	key := newFilterKey(info, inRate, outRate, mode, phases)
+
+	c.mu.Lock()
+	if c.limit <= 0 {
+		c.mu.Unlock()
+		return newFilter(info, inRate, outRate, mode, phases)
+	}
+	e, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(e.elem)
+	} else {
+		e = &cacheEntry{key: key}
+		e.elem = c.lru.PushFront(e)
+		c.entries[key] = e
+	}
+	c.mu.Unlock()
+
+	e.once.Do(func() {
+		e.f, e.err = newFilter(info, inRate, outRate, mode, phases)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.entries[key] != e {
+			return // evicted while being built
+		}
+		if e.err != nil {
+			c.remove(e)
+			return
+		}
+		e.size = e.f.size()
+		c.size += e.size
+		c.evict()
+	})
+	return e.f, e.err
+}
+
+func (c *filterCache) setLimit(limit int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limit = limit
+	c.evict()
+}
+
+// evict removes least recently used entries until the cache fits the limit.
+func (c *filterCache) evict() {
+	for c.size > c.limit || (c.limit <= 0 && c.lru.Len() > 0) {
+		c.remove(c.lru.Back().Value.(*cacheEntry)) //nolint:forcetypeassert // list holds only entries
+	}
+}
+
+func (c *filterCache) remove(e *cacheEntry) {
+	delete(c.entries, e.key)
+	c.lru.Remove(e.elem)
+	c.size -= e.size
+}
@@ -0,0 +1,101 @@
+package resample_test
+
+import (
+	"github.com/gunter-q12/resample"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+func newResampler(t *testing.T, inRate, outRate int, options ...resample.Option) *resample.Resampler {
+	t.Helper()
+	r, err := resample.New(nil, resample.FormatInt16, inRate, outRate, 1, options...)
+	require.NoError(t, err)
+	return r
+}
+
+func setFilterCacheLimit(t *testing.T, limit int) {
+	t.Helper()
+	resample.SetFilterCacheLimit(limit)
+	t.Cleanup(func() { resample.SetFilterCacheLimit(resample.DefaultFilterCacheLimit) })
+}
+
+func TestFilterCache(t *testing.T) {
+	setFilterCacheLimit(t, 0)
+	setFilterCacheLimit(t, resample.DefaultFilterCacheLimit)
+
+	r := newResampler(t, 44100, 16000)
+	assert.True(t, resample.SharesFilter(r, newResampler(t, 44100, 16000)))
+	assert.True(t, resample.SharesFilter(r, newResampler(t, 88200, 32000)), "same ratio")
+	assert.False(t, resample.SharesFilter(r, newResampler(t, 16000, 44100)))
+	assert.True(t, resample.SharesFilter(
+		newResampler(t, 44100, 44101, resample.WithQuantizedPhases(256)),
+		newResampler(t, 16000, 44100, resample.WithQuantizedPhases(256))),
+		"quantized filters depend only on scaling")
+	assert.False(t, resample.SharesFilter(r, newResampler(t, 44100, 16000, resample.WithNoMemoization())))
+	assert.False(t, resample.SharesFilter(r, newResampler(t, 44100, 16000, resample.WithKaiserBestFilter())))
+
+	k := newResampler(t, 44100, 16000, resample.WithKaiserFilter(12, 32, 8, 0.9))
+	assert.True(t, resample.SharesFilter(k, newResampler(t, 44100, 16000, resample.WithKaiserFilter(12, 32, 8, 0.9))))
+	assert.False(t, resample.SharesFilter(k, newResampler(t, 44100, 16000, resample.WithKaiserFilter(12, 32, 9, 0.9))))
+}
+
+func TestFilterCacheLimit(t *testing.T) {
+	setFilterCacheLimit(t, 0)
+	assert.Zero(t, resample.FilterCacheSize())
+	assert.False(t, resample.SharesFilter(newResampler(t, 3, 2), newResampler(t, 3, 2)))
+
+	// kaiser fast filter takes about 100 KB and does not fit
+	setFilterCacheLimit(t, 50000)
+	assert.False(t, resample.SharesFilter(newResampler(t, 3, 2), newResampler(t, 3, 2)))
+	assert.True(t, resample.SharesFilter(
+		newResampler(t, 3, 2, resample.WithKaiserFastestFilter()),
+		newResampler(t, 3, 2, resample.WithKaiserFastestFilter())))
+	assert.LessOrEqual(t, resample.FilterCacheSize(), 50000)
+
+	// the least recently used filters are evicted
+	first := newResampler(t, 100, 1, resample.WithKaiserFastestFilter())
+	for rate := 2; rate < 100; rate++ {
+		newResampler(t, 100, rate, resample.WithKaiserFastestFilter())
+		assert.LessOrEqual(t, resample.FilterCacheSize(), 50000)
+	}
+	last := newResampler(t, 100, 99, resample.WithKaiserFastestFilter())
+	assert.True(t, resample.SharesFilter(last, newResampler(t, 100, 99, resample.WithKaiserFastestFilter())))
+	assert.False(t, resample.SharesFilter(first, newResampler(t, 100, 1, resample.WithKaiserFastestFilter())))
+}
+
+func TestFilterCacheConcurrent(t *testing.T) {
+	setFilterCacheLimit(t, 0)
+	setFilterCacheLimit(t, resample.DefaultFilterCacheLimit)
+
+	resamplers := make([]*resample.Resampler, 32)
+	var wg sync.WaitGroup
+	for i := range resamplers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resamplers[i], _ = resample.New(nil, resample.FormatInt16, 48000, 44100, 1)
+		}()
+	}
+	wg.Wait()
+
+	for _, r := range resamplers {
+		require.NotNil(t, r)
+		assert.True(t, resample.SharesFilter(resamplers[0], r))
+	}
+}
+
+func TestWarmFilterCache(t *testing.T) {
+	setFilterCacheLimit(t, 0)
+	setFilterCacheLimit(t, resample.DefaultFilterCacheLimit)
+
+	require.NoError(t, resample.WarmFilterCache(48000, 8000, resample.WithKaiserBestFilter()))
+	size := resample.FilterCacheSize()
+	assert.Positive(t, size)
+
+	newResampler(t, 48000, 8000, resample.WithKaiserBestFilter())
+	assert.Equal(t, size, resample.FilterCacheSize())
+
+	require.ErrorIs(t, resample.WarmFilterCache(0, 8000), resample.ErrInvalidRate)
+}
@@ -11,13 +11,15 @@ import (
 )
 
 var (
-	format = flag.String("format", "", "PCM format: i16, i32, i64, f32, f64")
-	ch     = flag.Int("ch", 0, "Number of channels")
-	ir     = flag.Int("ir", 0, "Input sample rate in Hz")
-	or     = flag.Int("or", 0, "Output sample rate in Hz")
-	q      = flag.String("q", "kaiser_fast",
+	format  = flag.String("format", "", "PCM format: i16, i32, i64, f32, f64")
+	oformat = flag.String("oformat", "", "Output PCM format, same as -format if empty")
+	ch      = flag.Int("ch", 0, "Number of channels")
+	ir      = flag.Int("ir", 0, "Input sample rate in Hz")
+	or      = flag.Int("or", 0, "Output sample rate in Hz")
+	q       = flag.String("q", "kaiser_fast",
 		"Output quality: linear, kaiser_fast, kaiser_best")
-	mem = flag.Bool("ml", true, "Enable or disable memoization")
+	mem        = flag.Bool("ml", true, "Enable or disable memoization")
+	filterFile = flag.String("filter", "", "Path to a filter file, overrides -q")
 )
 
 var flagToFormat = map[string]resample.Format{
@@ -59,6 +61,10 @@ func main() {
 			*ir, *ch, *format)
 	}
 
+	if *oformat == "" {
+		*oformat = *format
+	}
+
 	out, err := os.Create(outputPath)
 	if err != nil {
 		log.Fatal(err)
@@ -70,13 +76,17 @@ func main() {
 		defer func(f *os.File, rate, ch int, format string) {
 			_, _ = f.Seek(0, io.SeekStart)
 			_ = writeHeader(f, rate, ch, format)
-		}(out, *or, *ch, *format)
+		}(out, *or, *ch, *oformat)
 	}
 
 	validateArgs()
 
 	options := []resample.Option{
 		flagToFilter[*q],
+		resample.WithOutputFormat(flagToFormat[*oformat]),
+	}
+	if *filterFile != "" {
+		options[0] = resample.WithFilterFile(*filterFile)
 	}
 	if !*mem {
 		options = append(options, resample.WithNoMemoization())
@@ -88,6 +98,9 @@ func main() {
 	}
 
 	_, err = io.Copy(res, in)
+	if err == nil {
+		err = res.Close()
+	}
 	if err != nil {
 		_ = os.Remove(outputPath)
 		log.Fatalf("Error while resampling: %s", err)
@@ -108,6 +121,9 @@ func validateArgs() {
 	if _, ok := flagToFormat[*format]; !ok {
 		log.Fatalf("Incorrect format:: %s", *format)
 	}
+	if _, ok := flagToFormat[*oformat]; !ok {
+		log.Fatalf("Incorrect output format: %s", *oformat)
+	}
 
 	if _, ok := flagToFilter[*q]; !ok {
 		log.Fatalf("Incorrect quality: %s", *q)
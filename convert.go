@@ -0,0 +1,130 @@
+package resample
+
+import (
+	"math"
+	"math/rand/v2"
+	"reflect"
+)
+
+// converter converts calculated float64 samples to T.
+//
+// Samples are multiplied by gain to match the output format.
+// For integer types samples are then dithered, rounded to the nearest integer
+// and saturated to the range of T.
+type converter[T number] struct {
+	gain       float64
+	isInt      bool
+	lo, hi     float64 // Range of T, lo is inclusive and hi is exclusive
+	minT, maxT T
+
+	ch     int
+	dither Dither
+	rng    *rand.Rand
+	coefs  []float64 // Noise shaping filter coefficients
+	errs   []float64 // Previous quantization errors, len(coefs) values per channel, newest first
+}
+
+// newConverter returns a new converter for T given a resampler.
+func newConverter[T number](r *Resampler) *converter[T] {
+	var lo int64
+	var hi uint64
+
+	switch reflect.TypeFor[T]().Kind() { //nolint:exhaustive // only integer kinds are saturated
+	case reflect.Int8:
+		lo, hi = math.MinInt8, math.MaxInt8
+	case reflect.Int16:
+		lo, hi = math.MinInt16, math.MaxInt16
+	case reflect.Int32:
+		lo, hi = math.MinInt32, math.MaxInt32
+	case reflect.Int64, reflect.Int:
+		lo, hi = math.MinInt64, math.MaxInt64
+	case reflect.Uint8:
+		hi = math.MaxUint8
+	case reflect.Uint16:
+		hi = math.MaxUint16
+	case reflect.Uint32:
+		hi = math.MaxUint32
+	case reflect.Uint64, reflect.Uint, reflect.Uintptr:
+		hi = math.MaxUint64
+	default:
+		return &converter[T]{gain: r.gain()}
+	}
+
+	coefs := noiseShapingCoefs[r.noiseShaping]
+	return &converter[T]{
+		gain:  r.gain(),
+		isInt: true,
+		lo:    float64(lo),
+		hi:    float64(hi) + 1,
+		minT:  T(lo),
+		maxT:  T(hi),
+
+		ch:     r.ch,
+		dither: r.dither,
+		rng:    rand.New(rand.NewPCG(r.ditherSeed, r.ditherSeed)), //nolint:gosec // dither needs no crypto
+		coefs:  coefs,
+		errs:   make([]float64, len(coefs)*r.ch),
+	}
+}
+
+// convert converts interleaved src samples to dst
+// and returns the number of clipped samples.
+func (c *converter[T]) convert(dst []T, src []float64) int {
+	if !c.isInt {
+		for i, sample := range src {
+			dst[i] = T(sample * c.gain)
+		}
+		return 0
+	}
+
+	clipped := 0
+	order := len(c.coefs)
+	for i, sample := range src {
+		sample *= c.gain
+		errs := c.errs[i%c.ch*order : (i%c.ch+1)*order]
+		for k, h := range c.coefs {
+			sample -= h * errs[k]
+		}
+
+		quantized := math.Round(sample + c.noise())
+		if order > 0 {
+			copy(errs[1:], errs)
+			errs[0] = quantized - sample
+		}
+
+		var isClipped bool
+		dst[i], isClipped = c.saturate(quantized)
+		if isClipped {
+			clipped++
+		}
+	}
+	return clipped
+}
+
+// saturate converts an integer-valued sample to T and reports whether it was clipped.
+func (c *converter[T]) saturate(sample float64) (T, bool) {
+	switch {
+	case sample >= c.hi:
+		return c.maxT, true
+	case sample < c.lo:
+		return c.minT, true
+	}
+	return T(sample), false
+}
+
+// noise returns a dither value in units of the least significant bit.
+func (c *converter[T]) noise() float64 {
+	switch c.dither {
+	case DitherRectangular:
+		return c.rng.Float64() - 0.5 //nolint:mnd // half of LSB
+	case DitherTriangular:
+		return c.rng.Float64() - c.rng.Float64()
+	case DitherNone:
+	}
+	return 0
+}
+
+// reset clears the noise shaping history.
+func (c *converter[T]) reset() {
+	clear(c.errs)
+}
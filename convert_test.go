@@ -0,0 +1,179 @@
+package resample_test
+
+import (
+	"bytes"
+	"github.com/gunter-q12/resample"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+)
+
+// midpoints returns a signal that being upsampled twice with a linear filter
+// has a value of 0.5 in every odd output sample.
+func midpoints() []int16 {
+	input := make([]int16, 20000)
+	for i := range input {
+		input[i] = int16(i % 2)
+	}
+	return input
+}
+
+// midpointsError returns an average error in odd samples of upsampled midpoints
+// and a sum of errors in all samples.
+func midpointsError(output []int16) (float64, float64) {
+	var avg, sum float64
+	for i, s := range output[:len(output)-2] {
+		ideal := 0.5
+		if i%2 == 0 {
+			ideal = float64(i / 2 % 2)
+		} else {
+			avg += float64(s) - ideal
+		}
+		sum += float64(s) - ideal
+	}
+	return avg / float64(len(output)/2), sum
+}
+
+func TestDither(t *testing.T) {
+	dithers := []struct {
+		name   string
+		dither resample.Dither
+		bias   float64
+	}{
+		{"none", resample.DitherNone, 0.5},
+		{"rectangular", resample.DitherRectangular, 0},
+		{"triangular", resample.DitherTriangular, 0},
+	}
+
+	for _, d := range dithers {
+		t.Run(d.name, func(t *testing.T) {
+			output, err := resample.ResampleSlice(nil, midpoints(), 1, 2, 1,
+				resample.WithLinearFilter(), resample.WithDither(d.dither), resample.WithDitherSeed(1))
+			require.NoError(t, err)
+
+			avg, _ := midpointsError(output)
+			assert.InDelta(t, d.bias, avg, 0.02)
+		})
+	}
+}
+
+func TestNoiseShaping(t *testing.T) {
+	t.Run("first order", func(t *testing.T) {
+		output, err := resample.ResampleSlice(nil, midpoints(), 1, 2, 1,
+			resample.WithLinearFilter(), resample.WithDither(resample.DitherTriangular),
+			resample.WithNoiseShaping(resample.NoiseShapingFirstOrder), resample.WithDitherSeed(1))
+		require.NoError(t, err)
+
+		// first order shaping keeps the accumulated error bounded
+		_, sum := midpointsError(output)
+		assert.Less(t, math.Abs(sum), 3.0)
+	})
+	t.Run("psychoacoustic", func(t *testing.T) {
+		output, err := resample.ResampleSlice(nil, midpoints(), 1, 2, 1,
+			resample.WithLinearFilter(), resample.WithDither(resample.DitherTriangular),
+			resample.WithNoiseShaping(resample.NoiseShapingPsychoacoustic), resample.WithDitherSeed(1))
+		require.NoError(t, err)
+
+		avg, _ := midpointsError(output)
+		assert.InDelta(t, 0, avg, 0.05)
+	})
+}
+
+func TestDitherSeed(t *testing.T) {
+	resampleWithSeed := func(seed uint64) []int16 {
+		output, err := resample.ResampleSlice(nil, midpoints(), 1, 2, 1,
+			resample.WithLinearFilter(), resample.WithDither(resample.DitherTriangular),
+			resample.WithDitherSeed(seed))
+		require.NoError(t, err)
+		return output
+	}
+
+	assert.Equal(t, resampleWithSeed(1), resampleWithSeed(1))
+	assert.NotEqual(t, resampleWithSeed(1), resampleWithSeed(2))
+}
+
+func TestDitherFloat(t *testing.T) {
+	input := []float64{0, 1, 0, 1}
+	output, err := resample.ResampleSlice(nil, input, 1, 2, 1,
+		resample.WithLinearFilter(), resample.WithDither(resample.DitherTriangular))
+	require.NoError(t, err)
+
+	assert.Equal(t, []float64{0, 0.5, 1, 0.5, 0, 0.5, 1, 0.5}, output)
+}
+
+func TestDitherErrors(t *testing.T) {
+	_, err := resample.ResampleSlice[int16](nil, nil, 1, 2, 1, resample.WithDither(resample.Dither(-1)))
+	require.ErrorIs(t, err, resample.ErrInvalidConversion)
+
+	_, err = resample.ResampleSlice[int16](nil, nil, 1, 2, 1, resample.WithNoiseShaping(resample.NoiseShaping(10)))
+	require.ErrorIs(t, err, resample.ErrInvalidConversion)
+}
+
+func TestOutputFormat(t *testing.T) {
+	t.Run("int16 to float32", func(t *testing.T) {
+		outBuf := new(bytes.Buffer)
+		res, err := resample.New(outBuf, resample.FormatInt16, 1, 1, 1,
+			resample.WithLinearFilter(), resample.WithOutputFormat(resample.FormatFloat32))
+		require.NoError(t, err)
+
+		_, err = res.Write(buffer(t, []int16{16384, -32768, 0, math.MaxInt16}).Bytes())
+		require.NoError(t, err)
+		require.NoError(t, res.Close())
+
+		assert.Equal(t, []float32{0.5, -1, 0, 32767.0 / 32768}, unBuffer[float32](t, outBuf))
+	})
+	t.Run("float64 to int16", func(t *testing.T) {
+		outBuf := new(bytes.Buffer)
+		res, err := resample.New(outBuf, resample.FormatFloat64, 1, 1, 1,
+			resample.WithLinearFilter(), resample.WithOutputFormat(resample.FormatInt16))
+		require.NoError(t, err)
+
+		_, err = res.Write(buffer(t, []float64{0.5, -1, 1, -0.25}).Bytes())
+		require.NoError(t, err)
+		require.NoError(t, res.Close())
+
+		assert.Equal(t, []int16{16384, -32768, 32767, -8192}, unBuffer[int16](t, outBuf))
+		assert.Equal(t, int64(1), res.Clipped())
+	})
+	t.Run("int16 to int32", func(t *testing.T) {
+		outBuf := new(bytes.Buffer)
+		res, err := resample.New(outBuf, resample.FormatInt16, 1, 1, 1,
+			resample.WithLinearFilter(), resample.WithOutputFormat(resample.FormatInt32))
+		require.NoError(t, err)
+
+		_, err = res.Write(buffer(t, []int16{1, -1, math.MinInt16}).Bytes())
+		require.NoError(t, err)
+		require.NoError(t, res.Close())
+
+		assert.Equal(t, []int32{1 << 16, -1 << 16, math.MinInt32}, unBuffer[int32](t, outBuf))
+	})
+	t.Run("kaiser int16 to float32", func(t *testing.T) {
+		input := make([]int16, 10000)
+		for i := range input {
+			input[i] = int16(20000 * math.Sin(float64(i)/20))
+		}
+
+		expected, err := resample.ResampleSlice(nil, input, 44100, 16000, 1)
+		require.NoError(t, err)
+
+		outBuf := new(bytes.Buffer)
+		res, err := resample.New(outBuf, resample.FormatInt16, 44100, 16000, 1,
+			resample.WithOutputFormat(resample.FormatFloat32))
+		require.NoError(t, err)
+		_, err = res.Write(buffer(t, input).Bytes())
+		require.NoError(t, err)
+		require.NoError(t, res.Close())
+		actual := unBuffer[float32](t, outBuf)
+
+		require.Len(t, actual, len(expected))
+		for i := range actual {
+			assert.InDelta(t, float64(expected[i])/32768, actual[i], 1.0/32768)
+		}
+	})
+}
+
+func TestOutputFormatError(t *testing.T) {
+	_, err := resample.New(nil, resample.FormatInt16, 1, 1, 1, resample.WithOutputFormat(resample.Format(42)))
+	require.ErrorIs(t, err, resample.ErrUnknownFormat)
+}
@@ -1,106 +1,501 @@
 package resample
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"math"
 	"runtime"
 	"sync"
 )
 
+// streamer is a format-independent view of a convolver used by Resampler.
+type streamer interface {
+	resample(input []byte) (int, error)
+	flush() error
+	retime()
+	frames() (int64, int64)
+	inputPosition(outputFrame int64) float64
+	outputPosition(inputFrame int64) float64
+}
+
 // convolver is a struct created before convolution and
 // contains all the information necessary for it.
 //
+// Convolver keeps the input history between resample calls,
+// so a stream split into several parts is resampled exactly the same
+// way as if it was passed at once.
+//
 // The main purpose of this struct is to avoid memory allocations
 // on each convolve call.
-type convolver[T number] struct {
-	r             *Resampler
-	frameFunc     frameCalcFunc[T]
-	timeIncrement float64
-	processed     int
+type convolver[I, O number] struct {
+	r         *Resampler
+	frameFunc frameCalcFunc
+	converter *converter[O]
+	wing      int // Maximal number of input frames covered by one wing of filters
+	lookahead int // Number of input frames covered by the right wing, see Resampler.Latency
+
+	inRate    int // Input rate of the stage, see Resampler.stageRates
+	outRate   int // Output rate of the stage
+	processed int // Number of output frames produced since the stream start
+	nextFrame int // Input frame of the next output frame
+	phase     int // Position of the next output frame after nextFrame in 1/outRate units
+	base      int // Input frame of the first frame stored in samples
+	total     int // Number of input frames pushed since the stream start, before decimation
+	offset    int // Position of the first output frame in 1/outRate units, see WithDelayCompensation
+
+	// pre are decimation stages applied to input before the convolver,
+	// each one halves the rate, see Resampler.decimation.
+	pre       []*convolver[float64, float64]
+	preBuffer []float64
+
+	// polyphase are kernels of interpolation by an integer factor, one per phase,
+	// each one covers input frames starting polyLeft frames before the current one.
+	polyphase [][]float64
+	polyLeft  []int
 
 	convBuffer  []float64
-	parseBuffer []T
+	outBytes    []byte // Encoded output frames
+	partial     []byte // Incomplete frame received at the end of the last input
+	parseBuffer []I
 	samples     []float64
-	output      []T
+	results     []float64
+	output      []O
 }
 
-// newConvolver returns a new convolver given a resampler and
-// maximal possible input size in bytes.
-func newConvolver[T number](r *Resampler, maxInputSize int) *convolver[T] {
-	inFrames := maxInputSize / r.elemSize / r.ch
-	outFrames := int(float64(inFrames*r.outRate) / float64(r.inRate))
-	outSamples := outFrames * r.ch
+// newConvolver returns a new convolver given a resampler.
+func newConvolver[I, O number](r *Resampler) (*convolver[I, O], error) {
+	c := &convolver[I, O]{
+		r:         r,
+		converter: newConverter[O](r),
+		wing:      max(r.f.Length(0), r.fRight.Length(0)),
+		lookahead: r.fRight.Length(0),
 
-	c := &convolver[T]{
-		r:             r,
-		timeIncrement: float64(r.inRate) / float64(r.outRate),
+		convBuffer: make([]float64, runtime.NumCPU()*routinesPerCore*r.ch),
+	}
+	c.inRate, c.outRate = r.stageRates()
+	c.setFrameFunc()
+	if r.delayCompensation {
+		c.offset = int(math.Round(max(0, r.groupDelay()) * float64(c.outRate)))
+		c.start()
+	}
+
+	for stage := 1; stage < r.decimation; stage *= 2 {
+		// the last stage has the narrowest transition band
+		decimator, err := newDecimator(r.ch, r.decimation/stage/2) //nolint:mnd // each stage halves the rate
+		if err != nil {
+			return nil, err
+		}
+		c.pre = append(c.pre, decimator)
+	}
+	return c, nil
+}
 
-		convBuffer:  make([]float64, runtime.NumCPU()*routinesPerCore*r.ch),
-		parseBuffer: make([]T, maxInputSize/r.elemSize),
-		samples:     make([]float64, maxInputSize/r.elemSize),
-		output:      make([]T, outSamples),
+// newDecimator returns a convolver that halves the rate of float64 samples
+// with a filter designed for a given number of following decimation stages.
+func newDecimator(ch, following int) (*convolver[float64, float64], error) {
+	r, err := New(nil, FormatFloat64, 2, 1, ch, //nolint:mnd // halving the rate
+		WithSingleStage(), withFilter(decimationInfo(following)))
+	if err != nil {
+		return nil, err
 	}
+	return newConvolver[float64, float64](r)
+}
 
-	c.frameFunc = c.calcFrame
-	if c.r.memoization {
+// setFrameFunc chooses a frame calculation function for the current filter mode.
+func (c *convolver[I, O]) setFrameFunc() {
+	c.polyphase, c.polyLeft = nil, nil
+	switch c.r.mode {
+	case FilterModeMemoized:
 		c.frameFunc = c.calcFrameWithMemoization
+		if c.r.genericKernels {
+			break
+		}
+		if c.outRate == 1 && c.r.f == c.r.fRight {
+			c.frameFunc = c.calcFrameDecimated
+		}
+		if c.inRate == 1 && c.outRate > 1 {
+			c.setPolyphase()
+		}
+	case FilterModeQuantized:
+		c.frameFunc = c.calcFrameQuantized
+	case FilterModeInterpolated:
+		c.frameFunc = c.calcFrame
 	}
-	return c
 }
 
-// resample resamples part of a given input from a start to an end byte.
-func (c *convolver[T]) resample(input []byte, start, end int) (int, error) {
-	var err error
-	err = c.parseSamples(input)
-	if err != nil {
-		return 0, fmt.Errorf("resampler: resample: %w", err)
+// setPolyphase joins memoized left and right wings of each phase of interpolation
+// into a single kernel applied to consecutive input frames, see convolvePolyphase.
+func (c *convolver[I, O]) setPolyphase() {
+	phases := c.outRate
+	c.polyphase = make([][]float64, phases)
+	c.polyLeft = make([]int, phases)
+	for phase := range phases {
+		left := c.r.f.offsetWins[phase]
+		rightPhase := (phases - phase) % phases
+		right := c.r.fRight.offsetWins[rightPhase]
+		if rightPhase == 0 && len(right) > 0 { // the middle element belongs to the left wing
+			right = right[1:]
+		}
+
+		kernel := make([]float64, 0, len(left)+len(right))
+		for i := len(left) - 1; i >= 0; i-- {
+			kernel = append(kernel, left[i])
+		}
+		c.polyphase[phase] = append(kernel, right...)
+		c.polyLeft[phase] = len(left) - 1
 	}
+}
 
-	startSample := start / c.r.elemSize
-	endSample := end / c.r.elemSize
+// retime adapts the stream position and the filter to new rates.
+//
+// The phase of the next output frame is converted from 1/outRate units
+// of the previous rates to the new ones, so the frame stays at the same position.
+func (c *convolver[I, O]) retime() {
+	inRate, outRate := c.r.stageRates()
+	phase := math.Round(float64(c.phase) * float64(outRate) / float64(c.outRate))
+	c.offset = int(math.Round(float64(c.offset) * float64(outRate) / float64(c.outRate)))
+	c.inRate, c.outRate = inRate, outRate
+	c.phase = int(phase)
+	if c.phase == c.outRate {
+		c.nextFrame++
+		c.phase = 0
+	}
 
-	inFrames := (endSample - startSample) / c.r.ch
-	outFrames := int(float64(inFrames*c.r.outRate) / float64(c.r.inRate))
-	outSamples := outFrames * c.r.ch
-	c.output = c.output[:outSamples]
+	c.wing = max(c.r.f.Length(0), c.r.fRight.Length(0))
+	c.lookahead = c.r.fRight.Length(0)
+	c.setFrameFunc()
+}
 
-	c.convolve(startSample)
+// resample appends input to the stream and writes all the output frames
+// which do not depend on the input that has not been received yet.
+//
+// An incomplete frame at the end of input is kept until the next call.
+func (c *convolver[I, O]) resample(input []byte) (int, error) {
+	n := len(input)
+	frameSize := c.r.elemSize * c.r.ch
+
+	if len(c.partial) > 0 {
+		k := min(frameSize-len(c.partial), len(input))
+		c.partial = append(c.partial, input[:k]...)
+		input = input[k:]
+		if len(c.partial) < frameSize {
+			return n, nil
+		}
+		if err := c.parseSamples(c.partial); err != nil {
+			return 0, fmt.Errorf("resampler: resample: %w", err)
+		}
+		c.partial = c.partial[:0]
+	}
 
-	err = binary.Write(c.r.outBuf, binary.LittleEndian, c.output[:outSamples])
+	whole := len(input) - len(input)%frameSize
+	err := c.parseSamples(input[:whole])
 	if err != nil {
 		return 0, fmt.Errorf("resampler: resample: %w", err)
 	}
+	c.partial = append(c.partial, input[whole:]...)
 
-	c.processed += outSamples
-	return len(input), nil
+	err = c.emit(c.ready())
+	if err != nil {
+		return 0, fmt.Errorf("resampler: resample: %w", err)
+	}
+	return n, nil
 }
 
-// parseSamples parses input and loads it into samples field.
-func (c *convolver[T]) parseSamples(input []byte) error {
-	samples := c.parseBuffer[:len(input)/c.r.elemSize]
-	err := binary.Read(bytes.NewReader(input), binary.LittleEndian, &samples)
+// flush writes the remaining output frames treating all the input
+// after the end of the stream as zeroes and resets the convolver.
+//
+// An incomplete frame at the end of the stream is discarded
+// and ErrMisalignedInput is returned.
+func (c *convolver[I, O]) flush() error {
+	c.drain()
+	err := c.emit(c.remaining())
+	misaligned := len(c.partial) != 0
+	c.r.prevInputFrames += int64(c.total)
+	c.r.prevOutputFrames += int64(c.processed)
+	c.reset()
 	if err != nil {
+		return fmt.Errorf("resampler: flush: %w", err)
+	}
+	if misaligned {
+		return fmt.Errorf("resampler: flush: %w", ErrMisalignedInput)
+	}
+	return nil
+}
+
+// emit writes a given number of output frames.
+func (c *convolver[I, O]) emit(frames int) error {
+	output := c.process(frames)
+	if len(output) == 0 {
+		return nil
+	}
+	c.outBytes = appendSamples(c.outBytes[:0], output)
+	_, err := c.r.outBuf.Write(c.outBytes)
+	return err
+}
+
+// reset prepares convolver for a new stream.
+func (c *convolver[I, O]) reset() {
+	c.processed = 0
+	c.start()
+	c.base = 0
+	c.total = 0
+	c.samples = c.samples[:0]
+	c.partial = c.partial[:0]
+	c.converter.reset()
+	for _, stage := range c.pre {
+		stage.reset()
+	}
+}
+
+// start moves the next output frame to the position of the first one.
+func (c *convolver[I, O]) start() {
+	c.nextFrame = c.offset / c.outRate
+	c.phase = c.offset % c.outRate
+}
+
+// drain passes the input remaining in decimation stages to the convolver
+// treating the input after the end of the stream as zeroes.
+//
+// Output frames shifted by offset may be located after the end of the stream,
+// so zero frames covering the shift are appended as well.
+func (c *convolver[I, O]) drain() {
+	for i, stage := range c.pre {
+		output := stage.process(stage.remaining())
+		if i+1 < len(c.pre) {
+			c.pre[i+1].push(output)
+		} else {
+			c.samples = append(c.samples, output...)
+		}
+	}
+	if c.offset > 0 {
+		c.samples = append(c.samples, make([]float64, (c.offset/c.outRate+1)*c.r.ch)...)
+	}
+}
+
+// received returns the number of input frames received since the stream start.
+func (c *convolver[I, O]) received() int {
+	return c.base + len(c.samples)/c.r.ch
+}
+
+// process calculates a given number of output frames starting from the next one.
+//
+// Returned slice is valid until the next process call.
+func (c *convolver[I, O]) process(frames int) []O {
+	outSamples := frames * c.r.ch
+	if cap(c.output) < outSamples {
+		c.output = make([]O, outSamples)
+		c.results = make([]float64, outSamples)
+	}
+	c.output = c.output[:outSamples]
+	c.results = c.results[:outSamples]
+	if frames == 0 {
+		return c.output
+	}
+
+	c.convolve(frames)
+	clipped := c.converter.convert(c.output, c.results)
+	c.r.clipped.Add(int64(clipped))
+
+	c.advance(frames)
+	c.dropHistory()
+	return c.output
+}
+
+// frames returns the number of input frames received
+// and output frames produced since the stream start.
+func (c *convolver[I, O]) frames() (int64, int64) {
+	return int64(c.total), int64(c.processed)
+}
+
+// inputPosition returns the position of an output frame in the original input frames.
+//
+// The position is calculated from the next output frame with integer arithmetic,
+// so it is exact up to float64 rounding of the result.
+func (c *convolver[I, O]) inputPosition(outputFrame int64) float64 {
+	d := int64(c.r.decimation)
+	t := int64(c.phase) + (outputFrame-int64(c.processed))*int64(c.inRate)
+	frame, phase := floorDiv(t, int64(c.outRate))
+	return float64((int64(c.nextFrame)+frame)*d) + float64(phase*d)/float64(c.outRate)
+}
+
+// outputPosition returns the position of an original input frame in output frames.
+func (c *convolver[I, O]) outputPosition(inputFrame int64) float64 {
+	d := int64(c.r.decimation)
+	span := inputFrame*int64(c.outRate) - (int64(c.nextFrame)*int64(c.outRate)+int64(c.phase))*d
+	frames, rest := floorDiv(span, int64(c.inRate)*d)
+	return float64(int64(c.processed)+frames) + float64(rest)/float64(int64(c.inRate)*d)
+}
+
+// floorDiv returns the quotient rounded down and the non-negative remainder of a/b for positive b.
+func floorDiv(a, b int64) (int64, int64) {
+	q, r := a/b, a%b
+	if r < 0 {
+		q--
+		r += b
+	}
+	return q, r
+}
+
+// ready returns the number of output frames
+// that do not depend on the input that has not been received yet.
+func (c *convolver[I, O]) ready() int {
+	return c.framesUntil(c.received() - 1 - c.lookahead)
+}
+
+// framesUntil returns the number of output frames
+// located before or at the lastFrame input frame.
+func (c *convolver[I, O]) framesUntil(lastFrame int) int {
+	if lastFrame < c.nextFrame {
+		return 0
+	}
+	span := (lastFrame-c.nextFrame+1)*c.outRate - c.phase
+	return (span + c.inRate - 1) / c.inRate
+}
+
+// remaining returns the number of output frames located
+// before the end of the stream in the original input shifted by offset.
+//
+// Decimation stages may produce an extra frame from the zero padding,
+// so frames are counted in the units of the original input.
+func (c *convolver[I, O]) remaining() int {
+	d := c.r.decimation
+	span := c.total*c.outRate + (c.offset-c.nextFrame*c.outRate-c.phase)*d
+	return max(0, (span+c.inRate*d-1)/(c.inRate*d))
+}
+
+// advance moves the position of the next output frame by a given number of frames.
+func (c *convolver[I, O]) advance(frames int) {
+	t := c.phase + frames*c.inRate
+	c.nextFrame += t / c.outRate
+	c.phase = t % c.outRate
+	c.processed += frames
+}
+
+// dropHistory removes samples that are not needed for future output frames.
+func (c *convolver[I, O]) dropHistory() {
+	keepFrom := min(max(c.nextFrame-c.wing, c.base), c.received())
+	n := copy(c.samples, c.samples[(keepFrom-c.base)*c.r.ch:])
+	c.samples = c.samples[:n]
+	c.base = keepFrom
+}
+
+// parseSamples parses input and appends it to samples field.
+func (c *convolver[I, O]) parseSamples(input []byte) error {
+	n := len(input) / c.r.elemSize
+	if cap(c.parseBuffer) < n {
+		c.parseBuffer = make([]I, n)
+	}
+	samples := c.parseBuffer[:n]
+	if err := decodeSamples(samples, input); err != nil {
 		return fmt.Errorf("getting samples: %w", err)
 	}
 
-	c.samples = c.samples[:len(samples)]
-	for i, s := range samples {
-		c.samples[i] = float64(s)
+	c.push(samples)
+	return nil
+}
+
+// decodeSamples decodes little-endian samples of a Format from src to dst.
+//
+// Unlike binary.Read, it does not allocate memory, see WithRealtime.
+func decodeSamples[T number](dst []T, src []byte) error {
+	if len(src) < binary.Size(dst) {
+		return io.ErrUnexpectedEOF
+	}
+	switch d := any(dst).(type) {
+	case []int16:
+		for i := range d {
+			d[i] = int16(binary.LittleEndian.Uint16(src[2*i:])) //nolint:gosec // two's complement
+		}
+	case []int32:
+		for i := range d {
+			d[i] = int32(binary.LittleEndian.Uint32(src[4*i:])) //nolint:gosec // two's complement
+		}
+	case []int64:
+		for i := range d {
+			d[i] = int64(binary.LittleEndian.Uint64(src[8*i:])) //nolint:gosec // two's complement
+		}
+	case []float32:
+		for i := range d {
+			d[i] = math.Float32frombits(binary.LittleEndian.Uint32(src[4*i:]))
+		}
+	case []float64:
+		for i := range d {
+			d[i] = math.Float64frombits(binary.LittleEndian.Uint64(src[8*i:]))
+		}
+	default:
+		_, err := binary.Decode(src, binary.LittleEndian, dst)
+		return err
 	}
 	return nil
 }
 
-// convolve performs convolution between samples and a filter window.
-func (c *convolver[T]) convolve(startSample int) {
-	ch := c.r.ch
+// appendSamples appends little-endian encoded samples of a Format to dst.
+//
+// Unlike binary.Write, it does not allocate memory if dst has enough capacity.
+func appendSamples[T number](dst []byte, src []T) []byte {
+	switch s := any(src).(type) {
+	case []int16:
+		for _, v := range s {
+			dst = binary.LittleEndian.AppendUint16(dst, uint16(v)) //nolint:gosec // two's complement
+		}
+	case []int32:
+		for _, v := range s {
+			dst = binary.LittleEndian.AppendUint32(dst, uint32(v)) //nolint:gosec // two's complement
+		}
+	case []int64:
+		for _, v := range s {
+			dst = binary.LittleEndian.AppendUint64(dst, uint64(v)) //nolint:gosec // two's complement
+		}
+	case []float32:
+		for _, v := range s {
+			dst = binary.LittleEndian.AppendUint32(dst, math.Float32bits(v))
+		}
+	case []float64:
+		for _, v := range s {
+			dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(v))
+		}
+	default:
+		dst, _ = binary.Append(dst, binary.LittleEndian, src)
+	}
+	return dst
+}
+
+// push appends samples to samples field passing them through decimation stages.
+func (c *convolver[I, O]) push(samples []I) {
+	c.total += len(samples) / c.r.ch
+	if len(c.pre) == 0 {
+		for _, s := range samples {
+			c.samples = append(c.samples, float64(s))
+		}
+		return
+	}
+
+	input := c.preBuffer[:0]
+	for _, s := range samples {
+		input = append(input, float64(s))
+	}
+	c.preBuffer = input
+
+	for _, stage := range c.pre {
+		stage.push(input)
+		input = stage.process(stage.ready())
+	}
+	c.samples = append(c.samples, input...)
+}
+
+// convolve performs convolution between samples and a filter window
+// for a given number of output frames starting from the next one.
+//
+// Frames are split between goroutines unless there are too few of them
+// or the Resampler works in real-time mode, see WithRealtime.
+func (c *convolver[I, O]) convolve(frames int) {
 	routines := runtime.NumCPU() * routinesPerCore
-	frames := len(c.output) / ch
-	framesPerRoutine := (frames + routines - 1) / routines
-	if frames < routines {
-		routines = 1
-		framesPerRoutine = frames
+	if frames < routines || c.r.realtime {
+		c.convolveBatch(c.convBuffer[:c.r.ch], 0, frames)
+		return
 	}
+	framesPerRoutine := (frames + routines - 1) / routines
 
 	wg := sync.WaitGroup{}
 	for i := range routines {
@@ -108,39 +503,115 @@ func (c *convolver[T]) convolve(startSample int) {
 		go func() {
 			defer wg.Done()
 			startFrame := framesPerRoutine * i
-			batchSize := min(framesPerRoutine, frames-startFrame)
-			newSamples := c.convBuffer[i*ch : (i+1)*ch]
-			for currFrame := range batchSize {
-				outputFrame := startFrame + currFrame
-				inputTime := float64(outputFrame) * c.timeIncrement
-				inputFrame := int(inputTime) + (startSample / ch)
-
-				c.frameFunc(newSamples, inputTime, inputFrame, outputFrame)
-
-				start := outputFrame * ch
-				for s, sample := range newSamples {
-					c.output[start+s] = T(sample)
-					newSamples[s] = 0
-				}
-			}
+			batchSize := max(0, min(framesPerRoutine, frames-startFrame))
+			c.convolveBatch(c.convBuffer[i*c.r.ch:(i+1)*c.r.ch], startFrame, batchSize)
 		}()
 	}
 	wg.Wait()
 }
 
-type frameCalcFunc[T number] func([]float64, float64, int, int)
+// convolveBatch calculates batchSize output frames starting from startFrame
+// using newSamples as a buffer for one frame.
+func (c *convolver[I, O]) convolveBatch(newSamples []float64, startFrame, batchSize int) {
+	if c.polyphase != nil {
+		c.convolvePolyphase(newSamples, startFrame, batchSize)
+		return
+	}
+
+	ch := c.r.ch
+	for currFrame := range batchSize {
+		outputFrame := startFrame + currFrame
+		t := c.phase + outputFrame*c.inRate
+		inputFrame := c.nextFrame + t/c.outRate - c.base
+
+		c.frameFunc(newSamples, inputFrame, t%c.outRate)
+
+		start := outputFrame * ch
+		for s, sample := range newSamples {
+			c.results[start+s] = sample
+			newSamples[s] = 0
+		}
+	}
+}
+
+// convolvePolyphase calculates batchSize output frames starting from startFrame
+// for interpolation by an integer factor.
+//
+// Phases of consecutive output frames are tracked without divisions, and each frame
+// is a dot product of a kernel and consecutive input frames. Frames near the stream edges,
+// where the kernel does not fit into the input, are calculated by frameFunc.
+func (c *convolver[I, O]) convolvePolyphase(newSamples []float64, startFrame, batchSize int) {
+	ch := c.r.ch
+	batchNum := len(c.samples) / ch
+	t := c.phase + startFrame
+	inputFrame := c.nextFrame + t/c.outRate - c.base
+	phase := t % c.outRate
+
+	for outputFrame := startFrame; outputFrame < startFrame+batchSize; outputFrame++ {
+		kernel := c.polyphase[phase]
+		first := inputFrame - c.polyLeft[phase]
+		output := c.results[outputFrame*ch : (outputFrame+1)*ch]
+		if first >= 0 && first+len(kernel) <= batchNum {
+			dotFrames(output, kernel, c.samples[first*ch:(first+len(kernel))*ch])
+		} else {
+			c.frameFunc(newSamples, inputFrame, phase)
+			copy(output, newSamples)
+			clear(newSamples)
+		}
+
+		phase++
+		if phase == c.outRate {
+			phase = 0
+			inputFrame++
+		}
+	}
+}
+
+// dotFrames writes to dst a sum of frames of interleaved samples weighted by kernel.
+//
+// Sums are accumulated in local variables for common numbers of channels.
+func dotFrames(dst, kernel, samples []float64) {
+	switch len(dst) {
+	case 1:
+		samples = samples[:len(kernel)]
+		var sum float64
+		for i, weight := range kernel {
+			sum += weight * samples[i]
+		}
+		dst[0] = sum
+	case 2: //nolint:mnd // stereo
+		samples = samples[:2*len(kernel)]
+		var left, right float64
+		for i, weight := range kernel {
+			left += weight * samples[2*i]
+			right += weight * samples[2*i+1]
+		}
+		dst[0], dst[1] = left, right
+	default:
+		clear(dst)
+		for i, weight := range kernel {
+			frame := samples[i*len(dst) : (i+1)*len(dst)]
+			for s := range dst {
+				dst[s] += weight * frame[s]
+			}
+		}
+	}
+}
+
+// frameCalcFunc calculates a single output frame given
+// an index of the input frame in samples and a phase in 1/outRate units.
+type frameCalcFunc func([]float64, int, int)
 
 // calcFrame calculates a single output frame and writes it to
 // newSamples. Does not use precomputed window offsets.
-func (c *convolver[T]) calcFrame(
-	newSamples []float64, inputTime float64, inputFrame, _ int,
+func (c *convolver[I, O]) calcFrame(
+	newSamples []float64, inputFrame, phase int,
 ) {
 	f := c.r.f
 	ch := c.r.ch
 	batchNum := len(c.samples) / ch
 
-	offset := inputTime + float64(c.processed/ch)*c.timeIncrement
-	offset -= float64(int(offset))
+	offset := float64(phase) / float64(c.outRate)
 
 	// computing left wing including the middle element
 	iters := min(f.Length(offset), inputFrame+1)
@@ -153,6 +624,7 @@ func (c *convolver[T]) calcFrame(
 	}
 
 	offset = 1 - offset
+	f = c.r.fRight
 
 	// computing right wing
 	iters = min(f.Length(offset), batchNum-1-inputFrame)
@@ -167,15 +639,15 @@ func (c *convolver[T]) calcFrame(
 
 // calcFrameWithMemoization calculates a single output frame
 // and writes it to newSamples. Uses precomputed window offsets.
-func (c *convolver[T]) calcFrameWithMemoization(
-	newSamples []float64, _ float64, inputFrame, outputFrame int,
+func (c *convolver[I, O]) calcFrameWithMemoization(
+	newSamples []float64, inputFrame, phase int,
 ) {
 	f := c.r.f
 	ch := c.r.ch
 	batchNum := len(c.samples) / ch
 
 	offsetsNum := len(f.offsetWins)
-	offset := (outputFrame + c.processed) % offsetsNum
+	offset := phase / (c.outRate / offsetsNum)
 
 	// computing left wing including the middle element
 	iters := min(len(f.offsetWins[offset]), inputFrame+1)
@@ -187,13 +659,14 @@ func (c *convolver[T]) calcFrameWithMemoization(
 	}
 
 	offset = (offsetsNum - offset) % offsetsNum
+	f = c.r.fRight
 
 	// computing right wing
 	start := 0
 	if offset == 0 { // avoid counting the first element twice
 		start = 1
 	}
-	iters = min(len(f.offsetWins[offset]), batchNum-1-inputFrame)
+	iters = min(len(f.offsetWins[offset]), start+batchNum-1-inputFrame)
 	iters = max(start, iters)
 	for i, weight := range f.offsetWins[offset][start:iters] {
 		startSample := (inputFrame + i + 1) * ch
@@ -202,3 +675,84 @@ func (c *convolver[T]) calcFrameWithMemoization(
 		}
 	}
 }
+
+// calcFrameDecimated calculates a single output frame
+// and writes it to newSamples for decimation by an integer factor with a symmetric filter.
+//
+// Decimation uses only the zero phase, which is symmetric around an input frame,
+// so each pair of input samples with the same weight is multiplied once
+// and weights known to be zero, e.g. in half-band filters, are skipped.
+// Frames near the stream edges are calculated by calcFrameWithMemoization.
+func (c *convolver[I, O]) calcFrameDecimated(
+	newSamples []float64, inputFrame, phase int,
+) {
+	f := c.r.f
+	ch := c.r.ch
+	batchNum := len(c.samples) / ch
+
+	switch {
+	case len(f.tapIndices) == 0:
+		weight := f.offsetWins[0][0]
+		for s := range newSamples {
+			newSamples[s] += weight * c.samples[inputFrame*ch+s]
+		}
+	case inputFrame >= f.tapIndices[len(f.tapIndices)-1] &&
+		inputFrame+f.tapIndices[len(f.tapIndices)-1] < batchNum:
+		weight := f.offsetWins[0][0]
+		for s := range newSamples {
+			newSamples[s] += weight * c.samples[inputFrame*ch+s]
+		}
+		for i, weight := range f.taps {
+			left := (inputFrame - f.tapIndices[i]) * ch
+			right := (inputFrame + f.tapIndices[i]) * ch
+			for s := range newSamples {
+				newSamples[s] += weight * (c.samples[left+s] + c.samples[right+s])
+			}
+		}
+	default:
+		c.calcFrameWithMemoization(newSamples, inputFrame, phase)
+	}
+}
+
+// calcFrameQuantized calculates a single output frame
+// and writes it to newSamples. Uses window values precomputed at quantized phases.
+func (c *convolver[I, O]) calcFrameQuantized(
+	newSamples []float64, inputFrame, phase int,
+) {
+	f := c.r.f
+	ch := c.r.ch
+	batchNum := len(c.samples) / ch
+
+	phasesNum := len(f.phaseWins)
+	position := phase * phasesNum
+	row := position / c.outRate
+	frac := float64(position-row*c.outRate) / float64(c.outRate)
+
+	// computing left wing including the middle element
+	wins, deltas := f.phaseWins[row], f.phaseDeltas[row]
+	iters := min(len(wins), inputFrame+1)
+	for i := range iters {
+		weight := wins[i] + frac*deltas[i]
+		startSample := (inputFrame - i) * ch
+		for s := range newSamples {
+			newSamples[s] += weight * c.samples[startSample+s]
+		}
+	}
+
+	// the right wing offset is 1 - offset, which lies between
+	// the (phasesNum-row-1)-th and the (phasesNum-row)-th phases
+	row = phasesNum - row - 1
+	frac = 1 - frac
+	f = c.r.fRight
+
+	// computing right wing
+	wins, deltas = f.phaseWins[row], f.phaseDeltas[row]
+	iters = min(len(wins), batchNum-1-inputFrame)
+	for i := range iters {
+		weight := wins[i] + frac*deltas[i]
+		startSample := (inputFrame + i + 1) * ch
+		for s := range newSamples {
+			newSamples[s] += weight * c.samples[startSample+s]
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !resample_nobest
+
+package resample
+
+import (
+	_ "embed"
+)
+
+// kaiserBestData is the embedded KaiserBestFilter window.
+// Build with the resample_nobest tag to exclude it from a binary.
+//
+//go:embed filters/kaiser_best_f64
+var kaiserBestData []byte
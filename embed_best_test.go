@@ -0,0 +1,16 @@
+//go:build !resample_nobest
+
+package resample_test
+
+import (
+	"github.com/gunter-q12/resample"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestKaiserBestEmbedded(t *testing.T) {
+	filters, err := resample.EmbeddedKaiserFilters()
+	require.NoError(t, err)
+	assert.True(t, filters["best"].Embedded)
+}
@@ -0,0 +1,13 @@
+//go:build !resample_nofast
+
+package resample
+
+import (
+	_ "embed"
+)
+
+// kaiserFastData is the embedded KaiserFastFilter window.
+// Build with the resample_nofast tag to exclude it from a binary.
+//
+//go:embed filters/kaiser_fast_f64
+var kaiserFastData []byte
@@ -0,0 +1,7 @@
+//go:build resample_nobest
+
+package resample
+
+// kaiserBestData is excluded by the resample_nobest build tag,
+// the KaiserBestFilter window is computed during a New call instead.
+var kaiserBestData []byte
@@ -0,0 +1,7 @@
+//go:build resample_nofast
+
+package resample
+
+// kaiserFastData is excluded by the resample_nofast build tag,
+// the KaiserFastFilter window is computed during a New call instead.
+var kaiserFastData []byte
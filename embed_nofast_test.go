@@ -0,0 +1,27 @@
+//go:build resample_nofast
+
+package resample_test
+
+import (
+	"github.com/gunter-q12/resample"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+)
+
+func TestKaiserFastComputed(t *testing.T) {
+	filters, err := resample.EmbeddedKaiserFilters()
+	require.NoError(t, err)
+	assert.False(t, filters["fast"].Embedded)
+
+	input := make([]float64, 1000)
+	for i := range input {
+		input[i] = math.Sin(float64(i) / 10)
+	}
+	output, err := resample.ResampleSlice(nil, input, 2, 1, 1, resample.WithKaiserFastFilter())
+	require.NoError(t, err)
+	for i := 100; i < 400; i++ {
+		assert.InDelta(t, math.Sin(float64(2*i)/10), output[i], 1e-3)
+	}
+}
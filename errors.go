@@ -0,0 +1,21 @@
+package resample
+
+import (
+	"errors"
+)
+
+var (
+	// ErrInvalidRate is returned when a sampling rate is not greater than zero
+	// or the ratio of rates is not supported, see New.
+	ErrInvalidRate = errors.New("sampling rate must be greater than zero")
+	// ErrInvalidChannels is returned when a number of channels is not greater than zero.
+	ErrInvalidChannels = errors.New("number of channels must be greater than zero")
+	// ErrUnknownFormat is returned when a Format value is not one of the declared constants.
+	ErrUnknownFormat = errors.New("unknown format")
+	// ErrMisalignedInput is returned when input does not consist of whole frames.
+	ErrMisalignedInput = errors.New("input is not aligned to frames")
+	// ErrInvalidFilter is returned when filter parameters are out of range.
+	ErrInvalidFilter = errors.New("invalid filter parameters")
+	// ErrInvalidConversion is returned when a Dither or NoiseShaping value is not one of the declared constants.
+	ErrInvalidConversion = errors.New("invalid conversion parameters")
+)
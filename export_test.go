@@ -0,0 +1,80 @@
+package resample
+
+// BlockFrames returns the number of frames read at once by Resampler.ReadFrom.
+func BlockFrames(r *Resampler) int {
+	return r.blockFrames()
+}
+
+// WingFrames returns the maximal number of frames covered by one filter wing.
+func WingFrames(r *Resampler) int {
+	return r.f.Length(0)
+}
+
+// KaiserWindow computes a Kaiser filter window.
+var KaiserWindow = kaiserWindow
+
+// BesselI0 computes the zeroth order modified Bessel function of the first kind.
+var BesselI0 = besselI0
+
+// KaiserParams are parameters of an embedded Kaiser filter.
+type KaiserParams struct {
+	ZeroCrossings int
+	Density       int
+	Beta          float64
+	Rolloff       float64
+	Window        []float64
+	Embedded      bool // Window is embedded rather than computed at runtime
+}
+
+// EmbeddedKaiserFilters returns parameters and windows of embedded Kaiser filters.
+func EmbeddedKaiserFilters() (map[string]KaiserParams, error) {
+	infos := map[string]filterInfo{
+		"fastest": kaiserFastestInfo,
+		"fast":    kaiserFastInfo,
+		"best":    kaiserBestInfo,
+	}
+
+	params := make(map[string]KaiserParams, len(infos))
+	for name, info := range infos {
+		window, err := info.window()
+		if err != nil {
+			return nil, err
+		}
+		params[name] = KaiserParams{
+			ZeroCrossings: (info.length - 1) / info.density,
+			Density:       info.density,
+			Beta:          info.beta,
+			Rolloff:       info.rolloff,
+			Window:        window,
+			Embedded:      info.data != nil,
+		}
+	}
+	return params, nil
+}
+
+// SharesFilter reports whether two resamplers use the same filter.
+func SharesFilter(a, b *Resampler) bool {
+	return a.f == b.f
+}
+
+// FilterCacheSize returns the memory used by the filter cache in bytes.
+func FilterCacheSize() int {
+	sharedFilters.mu.Lock()
+	defer sharedFilters.mu.Unlock()
+	return sharedFilters.size
+}
+
+// Rationalize approximates x by a fraction with terms not greater than limit.
+var Rationalize = rationalize
+
+// WithGenericKernels returns an option that disables dedicated kernels for integer ratios,
+// so results can be compared with the generic path.
+func WithGenericKernels() Option {
+	return Option{
+		precedence: memoizationPrecedence,
+		apply: func(r *Resampler) error {
+			r.genericKernels = true
+			return nil
+		},
+	}
+}
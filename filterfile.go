@@ -0,0 +1,185 @@
+package resample
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// filterMagic starts every filter file.
+const filterMagic = "RSFT"
+
+// maxFilterLength limits the number of values in one table of a filter file
+// to avoid huge allocations caused by a corrupted header.
+const maxFilterLength = 1 << 24
+
+const filterFlagScaled = 1
+
+// filterHeader precedes tables in a filter file.
+//
+// A filter file consists of the header followed by Length little-endian float64 values
+// of FilterSpec.Table and RightLength values of FilterSpec.RightTable.
+// Zero RightLength denotes a symmetric filter.
+type filterHeader struct {
+	Magic       [4]byte
+	Density     uint32
+	Flags       uint32
+	Length      uint32
+	RightLength uint32
+}
+
+// FilterInfo describes a headerless filter table.
+type FilterInfo struct {
+	// Length is the number of table values.
+	// If Length is zero, the table is read until the end of the input.
+	Length int
+	// Density is the number of table values per input sample.
+	Density int
+	// Scaled has the same meaning as FilterSpec.Scaled.
+	Scaled bool
+}
+
+// WithFilterFromReader function returns option
+// that configures [Resampler] to use a symmetric filter table read from r.
+//
+// The table is read as little-endian float64 values without a header,
+// i.e. in the same format as the embedded filters, and is described by info.
+// Reading happens during the WithFilterFromReader call, so the option may be reused.
+func WithFilterFromReader(r io.Reader, info FilterInfo) Option {
+	if info.Length < 0 || info.Length > maxFilterLength {
+		return errorOption(fmt.Errorf("resampler: filter from reader: %w", ErrInvalidFilter))
+	}
+
+	table, err := readTable(r, info.Length)
+	if err != nil {
+		return errorOption(fmt.Errorf("resampler: filter from reader: %w", err))
+	}
+
+	return WithFilter(FilterSpec{Table: table, Density: info.Density, Scaled: info.Scaled})
+}
+
+// WithFilterFile function returns option
+// that configures [Resampler] to use a filter read from a file written by FilterSpec.WriteTo.
+//
+// Reading happens during the WithFilterFile call, so the option may be reused.
+func WithFilterFile(path string) Option {
+	file, err := os.Open(path)
+	if err != nil {
+		return errorOption(fmt.Errorf("resampler: filter file: %w", err))
+	}
+	defer file.Close()
+
+	spec, err := ReadFilter(file)
+	if err != nil {
+		return errorOption(err)
+	}
+	return WithFilter(spec)
+}
+
+// ReadFilter reads a filter written by FilterSpec.WriteTo.
+func ReadFilter(r io.Reader) (FilterSpec, error) {
+	op := "resampler: read filter"
+
+	var header filterHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return FilterSpec{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if string(header.Magic[:]) != filterMagic || header.Density == 0 || header.Length == 0 ||
+		header.Length > maxFilterLength || header.RightLength > maxFilterLength {
+		return FilterSpec{}, fmt.Errorf("%s: %w: malformed header", op, ErrInvalidFilter)
+	}
+
+	spec := FilterSpec{
+		Density: int(header.Density),
+		Scaled:  header.Flags&filterFlagScaled != 0,
+	}
+
+	var err error
+	if spec.Table, err = readTable(r, int(header.Length)); err != nil {
+		return FilterSpec{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if header.RightLength == 0 {
+		return spec, nil
+	}
+	if spec.RightTable, err = readTable(r, int(header.RightLength)); err != nil {
+		return FilterSpec{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return spec, nil
+}
+
+// WriteTo writes the filter to w in the format read by ReadFilter and WithFilterFile.
+func (spec FilterSpec) WriteTo(w io.Writer) (int64, error) {
+	op := "resampler: write filter"
+
+	if _, err := spec.info(spec.Table); err != nil {
+		return 0, err
+	}
+	if spec.RightTable != nil {
+		if _, err := spec.info(spec.RightTable); err != nil {
+			return 0, err
+		}
+	}
+	if uint64(spec.Density) > math.MaxUint32 ||
+		len(spec.Table) > maxFilterLength || len(spec.RightTable) > maxFilterLength {
+		return 0, fmt.Errorf("%s: %w: filter is too large", op, ErrInvalidFilter)
+	}
+
+	header := filterHeader{
+		Density:     uint32(spec.Density),         //nolint:gosec // checked above
+		Length:      uint32(len(spec.Table)),      //nolint:gosec // checked above
+		RightLength: uint32(len(spec.RightTable)), //nolint:gosec // checked above
+	}
+	copy(header.Magic[:], filterMagic)
+	if spec.Scaled {
+		header.Flags |= filterFlagScaled
+	}
+
+	var n int64
+	for _, data := range []any{header, spec.Table, spec.RightTable} {
+		if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+			return n, fmt.Errorf("%s: %w", op, err)
+		}
+		n += int64(binary.Size(data))
+	}
+	return n, nil
+}
+
+// readTable reads length little-endian float64 values from r
+// or all values until the end of r if length is zero.
+func readTable(r io.Reader, length int) ([]float64, error) {
+	if length > 0 {
+		table := make([]float64, length)
+		if err := binary.Read(r, binary.LittleEndian, table); err != nil {
+			return nil, err
+		}
+		return table, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxFilterLength*8+1))
+	switch {
+	case err != nil:
+		return nil, err
+	case len(data) > maxFilterLength*8:
+		return nil, fmt.Errorf("%w: table is too large", ErrInvalidFilter)
+	case len(data)%8 != 0:
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	table := make([]float64, len(data)/8)
+	for i := range table {
+		table[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[i*8:]))
+	}
+	return table, nil
+}
+
+// errorOption returns an option that fails with err when applied.
+func errorOption(err error) Option {
+	return Option{
+		precedence: filterPrecedence,
+		apply: func(*Resampler) error {
+			return err
+		},
+	}
+}
@@ -1,34 +1,42 @@
 package resample
 
 import (
-	"embed"
-	"encoding/binary"
+	"bytes"
+	_ "embed"
 	"fmt"
+	"math"
+	"slices"
 )
 
-//go:embed filters
-var filtersDir embed.FS
+// Small filters are always embedded, large ones are embedded
+// unless excluded with build tags, see embed_best.go and embed_fast.go.
+var (
+	//go:embed filters/linear_f64
+	linearData []byte
+	//go:embed filters/kaiser_fastest_f64
+	kaiserFastestData []byte
+)
 
 type filter struct {
 	interpWin   []float64   // Window used for interpolation (scaled)
 	interpDelta []float64   // Differences calculated as interpWin[i+1] - interpWin[i]
 	offsetWins  [][]float64 // Window values at all points that may be used in calculations with current in/out ratio
+	phaseWins   [][]float64 // Window values at quantized offsets, i-th window corresponds to an offset of i/len(phaseWins)
+	phaseDeltas [][]float64 // Differences calculated as phaseWins[i+1] - phaseWins[i]
+	taps        []float64   // Nonzero values of offsetWins[0] after the middle one
+	tapIndices  []int       // Indices of taps in offsetWins[0]
 	crossings   int         // Number of zero-crossings
 	density     int         // Number of window values between two zero-crossings
 	scale       float64     // Window scaling used during downsamplig to avoid aliasing
 }
 
-func newFilter(info filterInfo, inRate, outRate int, memoization bool) *filter {
-	interpWin, err := readWindowFromFile(info.path, info.length)
+func newFilter(info filterInfo, inRate, outRate int, mode FilterMode, phases int) (*filter, error) {
+	interpWin, err := info.window()
 	if err != nil {
-		panic(fmt.Errorf("cannot open precompiled filter: %w", err))
-	}
-
-	scale := 1.0
-	if info.isScaled {
-		scale = min(1.0, float64(outRate)/float64(inRate))
+		return nil, err
 	}
 
+	scale := info.scale(inRate, outRate)
 	n := len(interpWin)
 	interpDelta := make([]float64, n)
 	interpWin[0] *= scale
@@ -45,41 +53,104 @@ func newFilter(info filterInfo, inRate, outRate int, memoization bool) *filter {
 		scale:       scale,
 	}
 
-	if !memoization {
-		return f
+	switch mode {
+	case FilterModeMemoized:
+		f.memoize(outRate / gcd(inRate, outRate))
+	case FilterModeQuantized:
+		f.quantize(phases)
+	case FilterModeInterpolated:
+		return f, nil
 	}
+	f.interpDelta = nil
 
-	// recalculating window values at all points that may be used
-	var offsetWins [][]float64
-	offsets := outRate / gcd(inRate, outRate)
-	offsetWins = make([][]float64, offsets)
-	timeIncrement := float64(inRate) / float64(outRate)
+	return f, nil
+}
+
+// memoize recalculates window values at all points that may be used,
+// i-th window corresponds to an offset of i/offsets.
+func (f *filter) memoize(offsets int) {
+	f.offsetWins = make([][]float64, offsets)
 	for i := range offsets {
-		offset := timeIncrement * float64(i)
-		offset -= float64(int(offset))
+		offset := float64(i) / float64(offsets)
 		length := f.Length(offset)
-		offsetWins[i] = make([]float64, length)
+		f.offsetWins[i] = make([]float64, length)
 		for j := range length {
-			offsetWins[i][j] = f.Value(offset, j)
+			f.offsetWins[i][j] = f.Value(offset, j)
 		}
 	}
-	f.offsetWins = offsetWins
-	f.interpDelta = nil
-	f.interpDelta = nil
+	f.findTaps()
+}
+
+// findTaps collects nonzero values of the zero offset window,
+// which are used by decimation by integer factors, see convolver.calcFrameDecimated.
+//
+// Half-band filters have every second value at zero when decimating by 2,
+// so skipping them halves the work of the cascade stages.
+func (f *filter) findTaps() {
+	win := f.offsetWins[0]
+	if len(win) == 0 {
+		return
+	}
+	threshold := math.Abs(win[0]) * zeroTapThreshold
+	for i, tap := range win[1:] {
+		if math.Abs(tap) > threshold {
+			f.taps = append(f.taps, tap)
+			f.tapIndices = append(f.tapIndices, i+1)
+		}
+	}
+}
+
+// zeroTapThreshold is a relative value of window values that are treated as zero.
+const zeroTapThreshold = 1e-12
 
-	return f
+// quantize calculates window values at offsets of i/phases, i = 0..phases,
+// and differences between adjacent phases.
+//
+// All phases have the same length, values beyond the end of the window are zero.
+func (f *filter) quantize(phases int) {
+	length := f.Length(0)
+	wins := make([][]float64, phases+1)
+	for i := range wins {
+		offset := float64(i) / float64(phases)
+		wins[i] = make([]float64, length)
+		for j := range min(length, f.Length(offset)) {
+			wins[i][j] = f.Value(offset, j)
+		}
+	}
+
+	f.phaseWins = wins[:phases]
+	f.phaseDeltas = make([][]float64, phases)
+	for i := range phases {
+		f.phaseDeltas[i] = make([]float64, length)
+		for j := range length {
+			f.phaseDeltas[i][j] = wins[i+1][j] - wins[i][j]
+		}
+	}
+}
+
+// size estimates memory used by the filter in bytes.
+func (f *filter) size() int {
+	n := len(f.interpWin) + len(f.interpDelta)
+	for _, win := range f.offsetWins {
+		n += len(win)
+	}
+	n += len(f.taps) + len(f.tapIndices)
+	for i := range f.phaseWins {
+		n += len(f.phaseWins[i]) + len(f.phaseDeltas[i])
+	}
+	return n * 8 //nolint:mnd // size of float64
 }
 
 // Length is the number of samples that one wing of the window covers
 // starting from given offset.
-func (f filter) Length(offset float64) int {
+func (f *filter) Length(offset float64) int {
 	return int(float64(f.crossings)/f.scale - offset)
 }
 
 // Value is a window value at a given point.
 //
 // Point is provided as a fraction and integer parts.
-func (f filter) Value(offset float64, index int) float64 {
+func (f *filter) Value(offset float64, index int) float64 {
 	position := (offset + float64(index)) * f.scale * float64(f.density)
 	integer := float64(int(position))
 	frac := position - integer
@@ -89,24 +160,147 @@ func (f filter) Value(offset float64, index int) float64 {
 	return weight
 }
 
-// readWindowFromFile reads precompiled filter window.
-func readWindowFromFile(path string, length int) ([]float64, error) {
-	op := "read window from file"
+// moments returns the zeroth and the first moments of the wing of the filter
+// as a function of a distance from an output frame in input frames.
+//
+// Integrals are approximated with the trapezoidal rule over table values.
+func (f *filter) moments() (float64, float64) {
+	step := 1 / (f.scale * float64(f.density))
+	var m0, m1 float64
+	for i, value := range f.interpWin {
+		if i == 0 || i == len(f.interpWin)-1 {
+			value /= 2
+		}
+		m0 += value * step
+		m1 += value * float64(i) * step * step
+	}
+	return m0, m1
+}
+
+// decimationAttenuation is the stopband attenuation of decimation stage filters in dB.
+const decimationAttenuation = 120
 
-	file, err := filtersDir.Open(path)
-	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+// decimationInfo returns a filter for a stage that halves the rate
+// followed by stages with a given total decimation factor, 1 for the last stage.
+//
+// The cascade output rate is at most 1/(2*following) of the stage output rate,
+// because the final stage downsamples at least twice, so the filter must pass
+// frequencies up to a half of it, and frequencies aliased into this passband
+// start at the stage output rate minus the same amount.
+// The filter length is estimated with the Kaiser formula.
+func decimationInfo(following int) filterInfo {
+	// passband and transition are relative to the stage input rate
+	passband := 0.5 / float64(4*following)                                     //nolint:mnd // see above
+	transition := 0.5 - 2*passband                                             //nolint:mnd // see above
+	length := (decimationAttenuation - 8) / (2.285 * 2 * math.Pi * transition) //nolint:mnd // Kaiser formula
+
+	// the filter is stretched twice, so a wing covers 2 samples per zero-crossing
+	zeroCrossings := int(math.Ceil(length / 4)) //nolint:mnd // two wings
+	return filterInfo{
+		length:   zeroCrossings*2 + 1,
+		density:  2, //nolint:mnd // values at the input samples are only needed
+		isScaled: true,
+		beta:     0.1102 * (decimationAttenuation - 8.7), //nolint:mnd // Kaiser formula
+		rolloff:  1,
 	}
+}
 
-	interpWin := make([]float64, length)
-	err = binary.Read(file, binary.LittleEndian, interpWin)
-	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+// scale returns window scaling for given rates.
+func (info filterInfo) scale(inRate, outRate int) float64 {
+	if !info.isScaled {
+		return 1.0
+	}
+	return min(1.0, float64(outRate)/float64(inRate))
+}
+
+// wing returns the number of input frames covered by one wing of the filter for given rates,
+// the same as filter.Length(0).
+func (info filterInfo) wing(inRate, outRate int) int {
+	return int(float64(info.length/info.density) / info.scale(inRate, outRate))
+}
+
+// memoizationSize estimates memory used by memoized window values in bytes.
+func (info filterInfo) memoizationSize(inRate, outRate int) int {
+	offsets := outRate / gcd(inRate, outRate)
+	length := float64(info.length/info.density)/info.scale(inRate, outRate) + 1
+	return saturatedSize(float64(offsets) * math.Floor(length) * 8) //nolint:mnd // size of float64
+}
+
+// quantizedSize estimates memory used by window values at quantized phases in bytes.
+func (info filterInfo) quantizedSize(inRate, outRate, phases int) int {
+	length := float64(info.length/info.density) / info.scale(inRate, outRate)
+	return saturatedSize(2 * float64(phases) * math.Floor(length) * 8) //nolint:mnd // values and differences of float64
+}
+
+// saturatedSize converts a size to int, sizes that do not fit are limited to math.MaxInt.
+func saturatedSize(size float64) int {
+	if size >= math.MaxInt {
+		return math.MaxInt
+	}
+	return int(size)
+}
+
+// window returns a copy of a user-supplied window, an embedded filter window
+// or computes it if there is no embedded one.
+func (info filterInfo) window() ([]float64, error) {
+	if info.table != nil {
+		return slices.Clone(info.table), nil
+	}
+	if info.data == nil {
+		zeroCrossings := (info.length - 1) / info.density
+		return kaiserWindow(zeroCrossings, info.density, info.beta, info.rolloff), nil
 	}
 
+	interpWin, err := decodeWindow(info.data, info.length)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode embedded filter: %w", err)
+	}
 	return interpWin, nil
 }
 
+// kaiserWindow computes the right half of a sinc function with a cutoff frequency
+// of rolloff multiplied by a Kaiser window with a given beta.
+//
+// The result has density values per zero-crossing and covers zeroCrossings of them.
+func kaiserWindow(zeroCrossings, density int, beta, rolloff float64) []float64 {
+	n := zeroCrossings*density + 1
+	interpWin := make([]float64, n)
+	norm := besselI0(beta)
+
+	for i := range n {
+		x := float64(i) / float64(density)
+		sinc := 1.0
+		if i > 0 {
+			sinc = math.Sin(math.Pi*rolloff*x) / (math.Pi * rolloff * x)
+		}
+
+		u := float64(i) / float64(n-1)
+		taper := besselI0(beta*math.Sqrt(1-u*u)) / norm
+
+		interpWin[i] = rolloff * sinc * taper
+	}
+	return interpWin
+}
+
+// besselI0 computes the zeroth order modified Bessel function of the first kind.
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	halfX := x / 2 //nolint:mnd // math
+	for k := 1; term > sum*1e-17; k++ {
+		term *= (halfX / float64(k)) * (halfX / float64(k))
+		sum += term
+	}
+	return sum
+}
+
+// decodeWindow decodes an embedded filter window.
+func decodeWindow(data []byte, length int) ([]float64, error) {
+	if len(data) != length*8 {
+		return nil, fmt.Errorf("decode window: %w: %d bytes for %d values", ErrInvalidFilter, len(data), length)
+	}
+	return readTable(bytes.NewReader(data), length)
+}
+
 func gcd(a, b int) int {
 	for b != 0 {
 		a, b = b, a%b
@@ -0,0 +1,421 @@
+package resample_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gunter-q12/resample"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBesselI0(t *testing.T) {
+	// values from scipy.special.i0
+	assert.InDelta(t, 1.0, resample.BesselI0(0), 1e-15)
+	assert.InEpsilon(t, 1.2660658777520082, resample.BesselI0(1), 1e-15)
+	assert.InEpsilon(t, 27.239871823604442, resample.BesselI0(5), 1e-15)
+	assert.InEpsilon(t, 2815.716628466254, resample.BesselI0(10), 1e-14)
+	assert.InEpsilon(t, 4.355828255955353e+07, resample.BesselI0(20), 1e-14)
+}
+
+func TestKaiserWindowMatchesEmbedded(t *testing.T) {
+	filters, err := resample.EmbeddedKaiserFilters()
+	require.NoError(t, err)
+
+	for name, f := range filters {
+		t.Run(name, func(t *testing.T) {
+			if !f.Embedded {
+				t.Skip("filter is excluded by a build tag")
+			}
+			window := resample.KaiserWindow(f.ZeroCrossings, f.Density, f.Beta, f.Rolloff)
+			require.Len(t, window, len(f.Window))
+
+			var maxDelta float64
+			for i := range window {
+				maxDelta = max(maxDelta, math.Abs(window[i]-f.Window[i]))
+			}
+			assert.Less(t, maxDelta, 1e-12)
+		})
+	}
+}
+
+func TestWithKaiserFilter(t *testing.T) {
+	input := make([]float64, 5000)
+	for i := range input {
+		input[i] = math.Sin(float64(i) / 10)
+	}
+
+	expected, err := resample.ResampleSlice(nil, input, 48000, 44100, 1,
+		resample.WithKaiserFastFilter())
+	require.NoError(t, err)
+
+	actual, err := resample.ResampleSlice(nil, input, 48000, 44100, 1,
+		resample.WithKaiserFilter(24, 512, 9.9032244164552541, 0.86821203883777842))
+	require.NoError(t, err)
+
+	assert.InDeltaSlice(t, expected, actual, 1e-10)
+}
+
+func TestWithKaiserFilterErrors(t *testing.T) {
+	options := []resample.Option{
+		resample.WithKaiserFilter(0, 512, 9, 0.9),
+		resample.WithKaiserFilter(24, 0, 9, 0.9),
+		resample.WithKaiserFilter(24, 512, -1, 0.9),
+		resample.WithKaiserFilter(24, 512, 9, 0),
+		resample.WithKaiserFilter(24, 512, 9, 1.1),
+	}
+	for _, option := range options {
+		_, err := resample.New(nil, resample.FormatInt16, 1, 2, 1, option)
+		require.ErrorIs(t, err, resample.ErrInvalidFilter)
+	}
+}
+
+func TestWithFilter(t *testing.T) {
+	input := make([]float64, 5000)
+	for i := range input {
+		input[i] = math.Sin(float64(i) / 10)
+	}
+
+	filters, err := resample.EmbeddedKaiserFilters()
+	require.NoError(t, err)
+	fast := filters["fast"]
+	spec := resample.FilterSpec{Table: fast.Window, Density: fast.Density, Scaled: true}
+
+	for _, rates := range [][2]int{{48000, 44100}, {44100, 48000}} {
+		for _, memoization := range []bool{true, false} {
+			memoOption := resample.Option{}
+			if !memoization {
+				memoOption = resample.WithNoMemoization()
+			}
+			expected, err := resample.ResampleSlice(nil, input, rates[0], rates[1], 1,
+				resample.WithKaiserFastFilter(), memoOption)
+			require.NoError(t, err)
+
+			actual, err := resample.ResampleSlice(nil, input, rates[0], rates[1], 1,
+				resample.WithFilter(spec), memoOption)
+			require.NoError(t, err)
+
+			assert.Equal(t, expected, actual)
+		}
+	}
+	assert.Equal(t, fast.Window, spec.Table, "table must not be modified")
+}
+
+func TestWithFilterLinear(t *testing.T) {
+	spec := resample.FilterSpec{Table: []float64{1, 0}, Density: 1}
+	output, err := resample.ResampleSlice(nil, []float64{1, 3, 5}, 1, 2, 1, resample.WithFilter(spec))
+	require.NoError(t, err)
+
+	assert.Equal(t, []float64{1, 2, 3, 4, 5, 2.5}, output)
+}
+
+func TestWithFilterAsymmetric(t *testing.T) {
+	// causal kernel that averages the current and three preceding samples
+	spec := resample.FilterSpec{
+		Table:      []float64{0.25, 0.25, 0.25, 0.25, 0},
+		RightTable: []float64{0, 0},
+		Density:    1,
+	}
+
+	input := make([]float64, 20)
+	input[10] = 1
+
+	for _, memoization := range []bool{true, false} {
+		memoOption := resample.Option{}
+		if !memoization {
+			memoOption = resample.WithNoMemoization()
+		}
+		output, err := resample.ResampleSlice(nil, input, 1, 1, 1, resample.WithFilter(spec), memoOption)
+		require.NoError(t, err)
+
+		expected := make([]float64, 20)
+		copy(expected[10:], []float64{0.25, 0.25, 0.25, 0.25})
+		assert.Equal(t, expected, output)
+	}
+}
+
+func TestWithFilterErrors(t *testing.T) {
+	specs := []resample.FilterSpec{
+		{Table: []float64{1, 0}, Density: 0},
+		{Table: []float64{1}, Density: 1},
+		{Table: []float64{1, math.NaN()}, Density: 1},
+		{Table: []float64{1, 0}, RightTable: []float64{math.Inf(1), 0}, Density: 1},
+	}
+	for _, spec := range specs {
+		_, err := resample.New(nil, resample.FormatInt16, 1, 2, 1, resample.WithFilter(spec))
+		require.ErrorIs(t, err, resample.ErrInvalidFilter)
+	}
+}
+
+func TestFilterFile(t *testing.T) {
+	specs := map[string]resample.FilterSpec{
+		"symmetric": {Table: []float64{1, 0.5, 0}, Density: 2, Scaled: true},
+		"asymmetric": {
+			Table:      []float64{0.25, 0.25, 0.25, 0.25, 0.25, 0},
+			RightTable: []float64{0, 0},
+			Density:    1,
+		},
+	}
+
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			n, err := spec.WriteTo(buf)
+			require.NoError(t, err)
+			assert.Equal(t, int64(buf.Len()), n)
+
+			path := filepath.Join(t.TempDir(), "filter")
+			require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+
+			actual, err := resample.ReadFilter(buf)
+			require.NoError(t, err)
+			assert.Equal(t, spec, actual)
+
+			input := make([]float64, 20)
+			input[10] = 1
+			expected, err := resample.ResampleSlice(nil, input, 2, 3, 1, resample.WithFilter(spec))
+			require.NoError(t, err)
+			output, err := resample.ResampleSlice(nil, input, 2, 3, 1, resample.WithFilterFile(path))
+			require.NoError(t, err)
+			assert.Equal(t, expected, output)
+		})
+	}
+}
+
+func TestWithFilterFromReader(t *testing.T) {
+	input := make([]float64, 5000)
+	for i := range input {
+		input[i] = math.Sin(float64(i) / 10)
+	}
+
+	filters, err := resample.EmbeddedKaiserFilters()
+	require.NoError(t, err)
+	fastest := filters["fastest"]
+	data := buffer(t, fastest.Window).Bytes()
+
+	expected, err := resample.ResampleSlice(nil, input, 48000, 44100, 1, resample.WithKaiserFastestFilter())
+	require.NoError(t, err)
+
+	for _, length := range []int{0, len(fastest.Window)} {
+		option := resample.WithFilterFromReader(bytes.NewReader(data),
+			resample.FilterInfo{Length: length, Density: fastest.Density, Scaled: true})
+
+		// the option is reusable
+		for range 2 {
+			actual, err := resample.ResampleSlice(nil, input, 48000, 44100, 1, option)
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		}
+	}
+}
+
+func TestFilterFileErrors(t *testing.T) {
+	valid := new(bytes.Buffer)
+	_, err := resample.FilterSpec{Table: []float64{1, 0.5, 0}, Density: 2}.WriteTo(valid)
+	require.NoError(t, err)
+
+	badMagic := bytes.Clone(valid.Bytes())
+	badMagic[0] = 'X'
+	_, err = resample.ReadFilter(bytes.NewReader(badMagic))
+	require.ErrorIs(t, err, resample.ErrInvalidFilter)
+
+	_, err = resample.ReadFilter(bytes.NewReader(valid.Bytes()[:valid.Len()-1]))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	_, err = resample.FilterSpec{Table: []float64{1}, Density: 1}.WriteTo(io.Discard)
+	require.ErrorIs(t, err, resample.ErrInvalidFilter)
+
+	_, err = resample.New(nil, resample.FormatInt16, 1, 2, 1,
+		resample.WithFilterFile(filepath.Join(t.TempDir(), "missing")))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = resample.New(nil, resample.FormatInt16, 1, 2, 1,
+		resample.WithFilterFromReader(bytes.NewReader(make([]byte, 12)), resample.FilterInfo{Density: 1}))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestMemoizationLimit(t *testing.T) {
+	input := make([]float64, 5000)
+	for i := range input {
+		input[i] = math.Sin(float64(i) / 10)
+	}
+
+	r, err := resample.NewSliceResampler[float64](44100, 16000, 1)
+	require.NoError(t, err)
+	assert.Equal(t, resample.FilterModeMemoized, r.FilterMode())
+
+	r, err = resample.NewSliceResampler[float64](44100, 16000, 1, resample.WithNoMemoization())
+	require.NoError(t, err)
+	assert.Equal(t, resample.FilterModeInterpolated, r.FilterMode())
+
+	// about 8 MB of memoized values do not fit the limit, but 400 KB of quantized ones do
+	r, err = resample.NewSliceResampler[float64](44100, 44101, 1, resample.WithMemoizationLimit(1<<20))
+	require.NoError(t, err)
+	assert.Equal(t, resample.FilterModeQuantized, r.FilterMode())
+
+	limited, err := resample.NewSliceResampler[float64](44100, 44101, 1,
+		resample.WithMemoizationLimit(100000))
+	require.NoError(t, err)
+	assert.Equal(t, resample.FilterModeInterpolated, limited.FilterMode())
+
+	expected, err := resample.ResampleSlice(nil, input, 44100, 44101, 1, resample.WithNoMemoization())
+	require.NoError(t, err)
+	actual, err := limited.Resample(nil, input)
+	require.NoError(t, err)
+	assert.Equal(t, expected, limited.Flush(actual))
+
+	r, err = resample.NewSliceResampler[float64](44100, 44101, 1, resample.WithMemoizationLimit(16<<20))
+	require.NoError(t, err)
+	assert.Equal(t, resample.FilterModeMemoized, r.FilterMode())
+
+	_, err = resample.New(nil, resample.FormatInt16, 1, 2, 1, resample.WithMemoizationLimit(-1))
+	require.ErrorIs(t, err, resample.ErrInvalidFilter)
+}
+
+func TestQuantizedPhases(t *testing.T) {
+	input := make([]float64, 5000)
+	for i := range input {
+		input[i] = math.Sin(float64(i) / 5)
+	}
+
+	filters := []struct {
+		name          string
+		option        resample.Option
+		zeroCrossings int
+		density       int
+	}{
+		{"fastest", resample.WithKaiserFastestFilter(), 12, 32},
+		{"fast", resample.WithKaiserFastFilter(), 24, 512},
+		{"best", resample.WithKaiserBestFilter(), 50, 8192},
+	}
+
+	for _, f := range filters {
+		for _, rates := range [][2]int{{44100, 44101}, {44101, 16000}, {3, 2}, {2, 3}} {
+			for _, phases := range []int{256, 1024} {
+				name := fmt.Sprintf("%s %d->%d %d phases", f.name, rates[0], rates[1], phases)
+				t.Run(name, func(t *testing.T) {
+					exact, err := resample.ResampleSlice(nil, input, rates[0], rates[1], 1,
+						f.option, resample.WithNoMemoization())
+					require.NoError(t, err)
+
+					r, err := resample.NewSliceResampler[float64](rates[0], rates[1], 1,
+						f.option, resample.WithQuantizedPhases(phases))
+					require.NoError(t, err)
+					require.Equal(t, resample.FilterModeQuantized, r.FilterMode())
+					quantized, err := r.Resample(nil, input)
+					require.NoError(t, err)
+					quantized = r.Flush(quantized)
+
+					// documented error bound
+					bound := float64(f.zeroCrossings) / float64(phases*min(phases, f.density))
+					require.Len(t, quantized, len(exact))
+					for i := range exact {
+						require.InDelta(t, exact[i], quantized[i], bound, "sample %d", i)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestQuantizedPhasesAsymmetric(t *testing.T) {
+	spec := resample.FilterSpec{
+		Table:      []float64{0.25, 0.25, 0.25, 0.25, 0.25, 0},
+		RightTable: []float64{0, 0},
+		Density:    1,
+	}
+
+	input := make([]float64, 20)
+	input[10] = 1
+	output, err := resample.ResampleSlice(nil, input, 1, 1, 1, resample.WithFilter(spec), resample.WithQuantizedPhases(4))
+	require.NoError(t, err)
+
+	expected := make([]float64, 20)
+	copy(expected[10:], []float64{0.25, 0.25, 0.25, 0.25, 0.25})
+	assert.Equal(t, expected, output)
+
+	_, err = resample.New(nil, resample.FormatInt16, 1, 2, 1, resample.WithQuantizedPhases(0))
+	require.ErrorIs(t, err, resample.ErrInvalidFilter)
+}
+
+func TestDelay(t *testing.T) {
+	// a causal-leaning filter: a slow decay before an output frame and a fast one after it
+	const density = 64
+	spec := resample.FilterSpec{
+		Table:      make([]float64, 12*density+1),
+		RightTable: make([]float64, 6*density+1),
+		Density:    density,
+		Scaled:     true,
+	}
+	for i := range spec.Table {
+		spec.Table[i] = math.Exp(-float64(i) / density / 3)
+	}
+	for i := range spec.RightTable {
+		spec.RightTable[i] = math.Exp(-float64(i) / density)
+	}
+
+	ramp := make([]float64, 200)
+	for i := range ramp {
+		ramp[i] = float64(i)
+	}
+	// the filter passes a ramp as a shifted ramp with a different slope
+	shift := func(output []float64) float64 {
+		slope := output[101] - output[100]
+		return 100 - output[100]/slope
+	}
+
+	res, err := resample.New(nil, resample.FormatFloat64, 48000, 48000, 1, resample.WithFilter(spec))
+	require.NoError(t, err)
+	delay := res.Delay()
+	assert.InDelta(t, 1.8, delay.InputFrames, 0.1)
+	assert.InDelta(t, delay.InputFrames, delay.OutputFrames, 1e-12)
+	assert.InDelta(t, delay.InputFrames/48000*float64(time.Second), float64(delay.Time), 1)
+
+	// a single phase of the filter is sampled at 1:1, so the shift differs from the average one
+	output, err := resample.ResampleSlice(nil, ramp, 1, 1, 1, resample.WithFilter(spec))
+	require.NoError(t, err)
+	assert.InDelta(t, delay.InputFrames, shift(output), 0.1)
+
+	compensated, err := resample.ResampleSlice(nil, ramp, 1, 1, 1, resample.WithFilter(spec),
+		resample.WithDelayCompensation())
+	require.NoError(t, err)
+	require.Len(t, compensated, len(output))
+	assert.InDelta(t, delay.InputFrames-math.Round(delay.InputFrames), shift(compensated), 0.1)
+
+	// finer ratios allow finer compensation
+	compensated, err = resample.ResampleSlice(nil, ramp, 100, 100*100, 1, resample.WithFilter(spec),
+		resample.WithDelayCompensation())
+	require.NoError(t, err)
+	require.Len(t, compensated, len(ramp)*100)
+	slope := compensated[10100] - compensated[10000]
+	assert.InDelta(t, 0, 100-compensated[10000]/slope, 0.05)
+
+	downsampled, err := resample.New(nil, resample.FormatFloat64, 2, 1, 1, resample.WithFilter(spec))
+	require.NoError(t, err)
+	assert.InDelta(t, 2*delay.InputFrames, downsampled.Delay().InputFrames, 1e-9)
+	assert.InDelta(t, delay.InputFrames, downsampled.Delay().OutputFrames, 1e-9)
+}
+
+func TestDelaySymmetric(t *testing.T) {
+	input := make([]float64, 1000)
+	for i := range input {
+		input[i] = math.Sin(float64(i) / 10)
+	}
+
+	for _, rate := range []struct{ ir, or int }{{1, 1}, {2, 3}, {192000, 8000}} {
+		res, err := resample.New(nil, resample.FormatFloat64, rate.ir, rate.or, 1)
+		require.NoError(t, err)
+		assert.Equal(t, resample.GroupDelay{}, res.Delay())
+
+		expected, err := resample.ResampleSlice(nil, input, rate.ir, rate.or, 1)
+		require.NoError(t, err)
+		output, err := resample.ResampleSlice(nil, input, rate.ir, rate.or, 1, resample.WithDelayCompensation())
+		require.NoError(t, err)
+		assert.Equal(t, expected, output)
+	}
+}
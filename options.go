@@ -1,6 +1,13 @@
 package resample
 
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
 const (
+	conversionPrecedence  = 0
 	filterPrecedence      = 50
 	memoizationPrecedence = 100
 )
@@ -15,11 +22,43 @@ func optionCmp(a, b Option) int {
 	return b.precedence - a.precedence
 }
 
+// DefaultMemoizationLimit is the default memory limit of memoized filter values in bytes.
+const DefaultMemoizationLimit = 64 << 20
+
+// FilterMode is a way [Resampler] evaluates filter values.
+type FilterMode int
+
+const (
+	// FilterModeMemoized precomputes filter values at all points used with the current ratio of rates.
+	FilterModeMemoized FilterMode = iota
+	// FilterModeInterpolated computes every filter value
+	// by interpolating between filter table points.
+	FilterModeInterpolated
+	// FilterModeQuantized precomputes filter values at a fixed number of phases
+	// between two input samples and linearly interpolates between adjacent phases.
+	FilterModeQuantized
+)
+
+// DefaultQuantizedPhases is the default number of phases used by FilterModeQuantized.
+const DefaultQuantizedPhases = 1024
+
+func (m FilterMode) String() string {
+	switch m {
+	case FilterModeMemoized:
+		return "memoized"
+	case FilterModeInterpolated:
+		return "interpolated"
+	case FilterModeQuantized:
+		return "quantized"
+	}
+	return fmt.Sprintf("FilterMode(%d)", int(m))
+}
+
 // WithNoMemoization function returns option that disables memoization in [Resampler].
 //
-// This option should be used when [Resampler] consumers too much memory.
-// Such behaviour may occur when resampling between
-// sampling rages with a small greatest common divisor (e.g. 9999 and 10000).
+// Memoization is disabled automatically when it needs more memory than
+// allowed by WithMemoizationLimit, so this option is needed only to
+// minimize memory usage regardless of the ratio of rates.
 //
 // Enabling this function slows the resampling progress significantly.
 // Therefore, most users should avoid it and switch used filter instead.
@@ -33,39 +72,189 @@ func WithNoMemoization() Option {
 	}
 }
 
-// fileInfo stores info about precompiled filters.
+// WithSingleStage function returns option that disables the multi-stage cascade in [Resampler].
+//
+// By default, when downsampling by a ratio of 4 or more, the input is first
+// decimated by 2 one or several times with short filters, and the remaining ratio
+// is handled by the configured filter, which is several times faster than
+// a single stage with the configured filter stretched by the whole ratio.
+// Use this option for exact single-stage results or when SetRates
+// will lower the ratio below 2 times the decimation factor.
+func WithSingleStage() Option {
+	return Option{
+		precedence: memoizationPrecedence,
+		apply: func(r *Resampler) error {
+			r.decimation = 1
+			return nil
+		},
+	}
+}
+
+// WithRealtime function returns option that configures [Resampler]
+// for live streams processed in small blocks, e.g. 10 ms VoIP frames.
+//
+// In real-time mode each Write call calculates output frames synchronously
+// on the caller's goroutine. Buffers grow during the first Write calls and are reused
+// afterwards, including after Flush, so Write of blocks of a fixed size
+// does not allocate memory, except in the io.Writer.
+// ReadFrom resamples every read immediately instead of accumulating batches.
+// The multi-stage cascade is disabled, so the latency is exactly
+// the right wing of the filter, see Resampler.Latency.
+func WithRealtime() Option {
+	return Option{
+		precedence: memoizationPrecedence,
+		apply: func(r *Resampler) error {
+			r.realtime = true
+			r.decimation = 1
+			return nil
+		},
+	}
+}
+
+// WithDelayCompensation function returns option that configures [Resampler]
+// to compensate the group delay of the filter, see Resampler.Delay.
+//
+// Output frames are calculated at input positions shifted by the delay,
+// rounded to the precision of the ratio of rates, which trims the delay
+// from the start of the output and pads its end with the zero input after the end of the stream,
+// so the output has the same length and is aligned with the input.
+// The shift increases the latency by the delay and is kept when SetRates changes the rates.
+// Symmetric filters have no delay, so the option has no effect on them.
+func WithDelayCompensation() Option {
+	return Option{
+		precedence: memoizationPrecedence,
+		apply: func(r *Resampler) error {
+			r.delayCompensation = true
+			return nil
+		},
+	}
+}
+
+// WithMemoizationLimit function returns option that sets a memory limit
+// of memoized filter values in bytes. The default is DefaultMemoizationLimit.
+//
+// Memoization needs memory proportional to outRate / gcd(inRate, outRate),
+// which is huge for rates with a small greatest common divisor (e.g. 44100 and 44101).
+// If the estimated size exceeds the limit, [Resampler] falls back to
+// FilterModeQuantized with DefaultQuantizedPhases or, if it does not fit either,
+// to FilterModeInterpolated. Use Resampler.FilterMode to check the chosen mode.
+// A negative limit results in ErrInvalidFilter.
+func WithMemoizationLimit(bytes int) Option {
+	return Option{
+		precedence: memoizationPrecedence,
+		apply: func(r *Resampler) error {
+			if bytes < 0 {
+				return fmt.Errorf("resampler: memoization limit: %w: negative limit %d", ErrInvalidFilter, bytes)
+			}
+			r.memoizationLimit = bytes
+			return nil
+		},
+	}
+}
+
+// WithQuantizedPhases function returns option that configures [Resampler]
+// to use FilterModeQuantized with a given number of phases regardless of
+// the ratio of rates, e.g. for ratios without a small period.
+//
+// Filter values are precomputed at a given number of points between two input samples,
+// so memory usage does not depend on rates, and values in between are linearly interpolated.
+// The interpolation error of an output sample does not exceed
+// zeroCrossings/(phases·min(phases, density)) of the full scale
+// (4e-4 for 256 phases and 5e-5 for 1024 phases with the default filter),
+// which is below the error of the filters themselves.
+//
+// WithNoMemoization takes precedence over this option.
+func WithQuantizedPhases(phases int) Option {
+	return Option{
+		precedence: memoizationPrecedence,
+		apply: func(r *Resampler) error {
+			if phases <= 0 {
+				return fmt.Errorf("resampler: quantized phases: %w: %d", ErrInvalidFilter, phases)
+			}
+			r.quantized = true
+			r.phases = phases
+			return nil
+		},
+	}
+}
+
+// chooseMode returns a mode of evaluating filters described by infos
+// that fits memoization settings.
+func (r *Resampler) chooseMode(infos ...filterInfo) FilterMode {
+	switch {
+	case !r.memoization:
+		return FilterModeInterpolated
+	case r.quantized:
+		return FilterModeQuantized
+	}
+
+	inRate, outRate := r.stageRates()
+	memoized, quantized := 0, 0
+	for _, info := range infos {
+		memoized += info.memoizationSize(inRate, outRate)
+		quantized += info.quantizedSize(inRate, outRate, r.phases)
+	}
+	switch {
+	case memoized <= r.memoizationLimit:
+		return FilterModeMemoized
+	case quantized <= r.memoizationLimit:
+		return FilterModeQuantized
+	}
+	return FilterModeInterpolated
+}
+
+// newFilter builds a filter for the resampler in a given mode.
+func (r *Resampler) newFilter(info filterInfo, mode FilterMode) (*filter, error) {
+	inRate, outRate := r.stageRates()
+	return newFilter(info, inRate, outRate, mode, r.phases)
+}
+
+// filterInfo stores info about precompiled filters.
+//
+// Kaiser filters also store parameters used to compute them.
+// If both table and data are nil, the window is computed from these parameters.
+// User-supplied filters store their window in table.
 type filterInfo struct {
-	path     string
+	table    []float64
+	data     []byte // Embedded window, nil if the window is computed at runtime
 	length   int
 	density  int
 	isScaled bool
+	beta     float64
+	rolloff  float64
 }
 
 //nolint:mnd // structs used as constants
 var (
 	linearInfo = filterInfo{
-		path:     "filters/linear_f64",
+		data:     linearData,
 		length:   2,
 		density:  1,
 		isScaled: false,
 	}
 	kaiserFastestInfo = filterInfo{
-		path:     "filters/kaiser_fastest_f64",
+		data:     kaiserFastestData,
 		length:   385,
 		density:  32,
 		isScaled: true,
+		beta:     8.0000590774907998,
+		rolloff:  0.90000224380538407,
 	}
 	kaiserFastInfo = filterInfo{
-		path:     "filters/kaiser_fast_f64",
+		data:     kaiserFastData,
 		length:   12289,
 		density:  512,
 		isScaled: true,
+		beta:     9.9032244164552541,
+		rolloff:  0.86821203883777842,
 	}
 	kaiserBestInfo = filterInfo{
-		path:     "filters/kaiser_best_f64",
+		data:     kaiserBestData,
 		length:   409601,
 		density:  8192,
 		isScaled: true,
+		beta:     12.984585247040171,
+		rolloff:  0.91734737126087607,
 	}
 )
 
@@ -91,6 +280,9 @@ func WithKaiserFastestFilter() Option {
 // that configures [Resampler] to use KaiserFastFilter.
 //
 // Used by default.
+//
+// If a binary is built with the resample_nofast tag, the filter window
+// is not embedded and is computed during a New call instead.
 func WithKaiserFastFilter() Option {
 	return withFilter(kaiserFastInfo)
 }
@@ -101,16 +293,240 @@ func WithKaiserFastFilter() Option {
 // Compared to default (Kaiser Fast) filter,
 // KaiserBestFilter provides higher resampling quality
 // in exchange for lower speed and higher memory usage.
+//
+// The filter window takes 3.2 MB of a binary. If the binary is built
+// with the resample_nobest tag, the window is not embedded
+// and is computed during a New call instead, which takes tens of milliseconds.
 func WithKaiserBestFilter() Option {
 	return withFilter(kaiserBestInfo)
 }
 
+// WithKaiserFilter function returns option
+// that configures [Resampler] to use a Kaiser filter computed during a New call.
+//
+// The filter is a sinc function with a cutoff frequency of rolloff
+// (relative to the Nyquist frequency) multiplied by a Kaiser window with a given beta.
+// One wing of the filter covers zeroCrossings of the sinc function
+// and is sampled density times between two zero-crossings.
+//
+// Larger zeroCrossings and beta improve stopband attenuation in exchange for
+// higher latency and lower speed, larger density improves interpolation precision
+// in exchange for higher memory usage. Embedded filters use the following parameters:
+//
+//	KaiserFastest: zeroCrossings 12, density 32,   beta 8.00,  rolloff 0.900
+//	KaiserFast:    zeroCrossings 24, density 512,  beta 9.90,  rolloff 0.868
+//	KaiserBest:    zeroCrossings 50, density 8192, beta 12.98, rolloff 0.917
+func WithKaiserFilter(zeroCrossings, density int, beta, rolloff float64) Option {
+	return Option{
+		precedence: filterPrecedence,
+		apply: func(r *Resampler) error {
+			if zeroCrossings <= 0 || density <= 0 || beta < 0 || rolloff <= 0 || rolloff > 1 {
+				return fmt.Errorf("resampler: kaiser filter: %w", ErrInvalidFilter)
+			}
+			return withFilter(filterInfo{
+				length:   zeroCrossings*density + 1,
+				density:  density,
+				isScaled: true,
+				beta:     beta,
+				rolloff:  rolloff,
+			}).apply(r)
+		},
+	}
+}
+
+// FilterSpec describes a user-supplied interpolation kernel.
+//
+// The kernel is stored as a table of its values at non-negative time
+// sampled Density times per input sample, i.e. Table[i] is the kernel value
+// at a distance of i/Density input samples from an output sample.
+// Values between table points are linearly interpolated.
+// The table should end with a zero value or decay to it.
+type FilterSpec struct {
+	// Table is applied to input samples preceding an output sample.
+	Table []float64
+	// RightTable is applied to input samples following an output sample.
+	// If RightTable is nil, the kernel is symmetric and Table is used instead.
+	// Asymmetric kernels, such as minimum-phase ones, require RightTable.
+	RightTable []float64
+	// Density is the number of table values per input sample.
+	Density int
+	// Scaled enables stretching of the kernel during downsampling to avoid aliasing.
+	// Should be set for lowpass kernels designed for a cutoff at the input Nyquist frequency.
+	Scaled bool
+}
+
+// WithFilter function returns option
+// that configures [Resampler] to use a user-supplied interpolation kernel.
+//
+// Tables are copied, so they may be modified after the WithFilter call.
+// Memoization is supported as for the embedded filters.
+func WithFilter(spec FilterSpec) Option {
+	spec.Table = slices.Clone(spec.Table)
+	spec.RightTable = slices.Clone(spec.RightTable)
+	return Option{
+		precedence: filterPrecedence,
+		apply: func(r *Resampler) error {
+			left, err := spec.info(spec.Table)
+			if err != nil {
+				return err
+			}
+			if spec.RightTable == nil {
+				r.mode = r.chooseMode(left)
+				r.f, err = r.newFilter(left, r.mode)
+				r.fRight = r.f
+				return err
+			}
+
+			right, err := spec.info(spec.RightTable)
+			if err != nil {
+				return err
+			}
+			r.mode = r.chooseMode(left, right)
+			if r.f, err = r.newFilter(left, r.mode); err != nil {
+				return err
+			}
+			r.fRight, err = r.newFilter(right, r.mode)
+			return err
+		},
+	}
+}
+
+// info validates a given table of the spec and returns filterInfo describing it.
+func (spec FilterSpec) info(table []float64) (filterInfo, error) {
+	if spec.Density <= 0 || len(table) <= spec.Density {
+		return filterInfo{}, fmt.Errorf("resampler: filter spec: %w", ErrInvalidFilter)
+	}
+	for _, v := range table {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return filterInfo{}, fmt.Errorf("resampler: filter spec: %w", ErrInvalidFilter)
+		}
+	}
+
+	return filterInfo{
+		table:    table,
+		length:   len(table),
+		density:  spec.Density,
+		isScaled: spec.Scaled,
+	}, nil
+}
+
 // withFilter is an actual implementation for all WithFilterX functions.
+//
+// Built filters are shared through the process-wide filter cache.
 func withFilter(info filterInfo) Option {
 	return Option{
 		precedence: filterPrecedence,
+		apply: func(r *Resampler) (err error) {
+			r.mode = r.chooseMode(info)
+			inRate, outRate := r.stageRates()
+			r.f, err = sharedFilters.get(info, inRate, outRate, r.mode, r.phases)
+			r.fRight = r.f
+			return err
+		},
+	}
+}
+
+// WithOutputFormat function returns option that configures [Resampler]
+// to write output in a format different from the input one.
+//
+// Integer samples are mapped to the [-1, 1) range when converted to float formats
+// and back, e.g. 16384 in FormatInt16 corresponds to 0.5 in FormatFloat32.
+// Float samples outside the range are saturated when converted to integer formats.
+func WithOutputFormat(format Format) Option {
+	return Option{
+		precedence: conversionPrecedence,
+		apply: func(r *Resampler) error {
+			if _, ok := formatElementSize[format]; !ok {
+				return fmt.Errorf("resampler: output format: %w: %d", ErrUnknownFormat, format)
+			}
+			r.outFormat = format
+			return nil
+		},
+	}
+}
+
+// Dither is a kind of noise added to samples before
+// they are quantized to an integer format.
+type Dither int
+
+const (
+	// DitherNone disables dithering.
+	DitherNone Dither = iota
+	// DitherRectangular adds noise uniformly distributed in [-0.5, 0.5) LSB.
+	DitherRectangular
+	// DitherTriangular adds noise with triangular distribution in (-1, 1) LSB (TPDF).
+	DitherTriangular
+)
+
+// NoiseShaping is a filter applied to the quantization error
+// to move it to less audible frequencies.
+type NoiseShaping int
+
+const (
+	// NoiseShapingNone disables noise shaping.
+	NoiseShapingNone NoiseShaping = iota
+	// NoiseShapingFirstOrder moves the quantization error to high frequencies
+	// with a first-order highpass filter.
+	NoiseShapingFirstOrder
+	// NoiseShapingPsychoacoustic uses 9th order F-weighted filter by Wannamaker
+	// that moves the quantization error to the least audible frequencies.
+	// The filter is designed for a 44.1 kHz output rate.
+	NoiseShapingPsychoacoustic
+)
+
+//nolint:mnd // map used as a constant
+var noiseShapingCoefs = map[NoiseShaping][]float64{
+	NoiseShapingNone:       nil,
+	NoiseShapingFirstOrder: {1},
+	NoiseShapingPsychoacoustic: {
+		2.412, -3.370, 3.937, -4.174, 3.353, -2.205, 1.281, -0.569, 0.0847,
+	},
+}
+
+// WithDither function returns option that configures [Resampler]
+// to add dither noise of a given kind before converting samples to an integer format.
+//
+// Dither decorrelates the quantization error from the signal.
+// It is not applied to float formats.
+func WithDither(kind Dither) Option {
+	return Option{
+		precedence: conversionPrecedence,
+		apply: func(r *Resampler) error {
+			if kind < DitherNone || kind > DitherTriangular {
+				return fmt.Errorf("resampler: dither: %w: %d", ErrInvalidConversion, kind)
+			}
+			r.dither = kind
+			return nil
+		},
+	}
+}
+
+// WithNoiseShaping function returns option that configures [Resampler]
+// to shape the quantization error spectrum when converting samples to an integer format.
+//
+// Noise shaping is usually combined with WithDither(DitherTriangular).
+// It is not applied to float formats.
+func WithNoiseShaping(shaping NoiseShaping) Option {
+	return Option{
+		precedence: conversionPrecedence,
+		apply: func(r *Resampler) error {
+			if _, ok := noiseShapingCoefs[shaping]; !ok {
+				return fmt.Errorf("resampler: noise shaping: %w: %d", ErrInvalidConversion, shaping)
+			}
+			r.noiseShaping = shaping
+			return nil
+		},
+	}
+}
+
+// WithDitherSeed function returns option that sets a seed of the dither noise generator.
+//
+// By default, the seed is random. A fixed seed makes the output reproducible.
+func WithDitherSeed(seed uint64) Option {
+	return Option{
+		precedence: conversionPrecedence,
 		apply: func(r *Resampler) error {
-			r.f = newFilter(info, r.inRate, r.outRate, r.memoization)
+			r.ditherSeed = seed
 			return nil
 		},
 	}
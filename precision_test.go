@@ -99,6 +99,13 @@ func TestResamplerPrecisionSpeech(t *testing.T) {
 			resample.WithNoMemoization(),
 		)
 	}
+	for _, tc := range testCases {
+		check(
+			t, "quantized "+tc.nameSuffix,
+			tc.tc, avgDelta[int16](tc.precision), tc.filter,
+			resample.WithQuantizedPhases(resample.DefaultQuantizedPhases),
+		)
+	}
 }
 
 // precision values were acquired from experiments with Resampy library
@@ -192,6 +199,13 @@ func TestResamplerPrecisionMusic(t *testing.T) {
 			resample.WithNoMemoization(),
 		)
 	}
+	for _, tc := range testCases {
+		check(
+			t, "quantized "+tc.nameSuffix,
+			tc.tc, avgDelta[int16](tc.precision), tc.filter,
+			resample.WithQuantizedPhases(resample.DefaultQuantizedPhases),
+		)
+	}
 }
 
 func avgDelta[T number](delta float64) checker[T] {
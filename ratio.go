@@ -0,0 +1,78 @@
+package resample
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// maxRatioTerm limits a numerator and a denominator of a rational approximation of a ratio.
+//
+// The approximation error is about 1/maxRatioTerm² relative to the ratio,
+// and phase arithmetic does not overflow int64.
+const maxRatioTerm = 1 << 24
+
+// NewWithRatio creates a new Resampler that converts inRate to inRate*ratio.
+//
+// It is used for ratios that are not ratios of small integers, e.g. 1.000023
+// to compensate a clock drift. The ratio is approximated by a fraction
+// with terms up to 2^24, Resampler.OutputRate returns the resulting output rate.
+// Such ratios usually have no small period, so memoization is replaced with
+// FilterModeQuantized unless configured otherwise.
+//
+// Arguments other than ratio and options are the same as in New.
+func NewWithRatio(outBuffer io.Writer, format Format, inRate int, ratio float64, ch int,
+	options ...Option) (*Resampler, error) {
+	if inRate <= 0 || math.IsNaN(ratio) || ratio < 1.0/maxRatioTerm || ratio > maxRatioTerm {
+		return nil, fmt.Errorf("resampler: new with ratio: %w: %v", ErrInvalidRate, ratio)
+	}
+
+	num, den := rationalize(ratio, maxRatioTerm)
+	r, err := New(outBuffer, format, den, num, ch, options...)
+	if err != nil {
+		return nil, err
+	}
+	r.inFreq = float64(inRate)
+	return r, nil
+}
+
+// rationalize returns the best approximation of x by a fraction num/den
+// with both terms not greater than limit using continued fractions.
+//
+// x must be in the range [1/limit, limit].
+func rationalize(x float64, limit int) (int, int) {
+	num, prevNum := 1, 0
+	den, prevDen := 0, 1
+
+	rest := x
+	for {
+		a := int(min(math.Floor(rest), float64(limit)))
+		nextNum := a*num + prevNum
+		nextDen := a*den + prevDen
+		if nextNum > limit || nextDen > limit {
+			// the closest semiconvergent that fits the limit may be better
+			if num == 0 || den == 0 {
+				break
+			}
+			a = min((limit-prevNum)/num, (limit-prevDen)/den)
+			semiNum, semiDen := a*num+prevNum, a*den+prevDen
+			if a > 0 && math.Abs(float64(semiNum)/float64(semiDen)-x) < math.Abs(float64(num)/float64(den)-x) {
+				return semiNum, semiDen
+			}
+			break
+		}
+		num, prevNum = nextNum, num
+		den, prevDen = nextDen, den
+
+		frac := rest - float64(a)
+		if frac == 0 {
+			break
+		}
+		rest = 1 / frac
+	}
+
+	if den == 0 { // x > limit
+		return limit, 1
+	}
+	return num, den
+}
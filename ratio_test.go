@@ -0,0 +1,294 @@
+package resample_test
+
+import (
+	"bytes"
+	"github.com/gunter-q12/resample"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"runtime"
+	"testing"
+)
+
+func TestRationalize(t *testing.T) {
+	testCases := []struct {
+		x        float64
+		limit    int
+		num, den int
+	}{
+		{0.5, 100, 1, 2},
+		{3, 100, 3, 1},
+		{1000.0 / 1001, 10000, 1000, 1001},
+		{16000.0 / 44100, 1000, 160, 441},
+		{math.Pi, 1000, 355, 113},
+		{math.Pi, 100, 22, 7},
+		{math.Pi, 330, 311, 99},
+		{1.000023, 1 << 24, 1000023, 1000000},
+	}
+	for _, tc := range testCases {
+		num, den := resample.Rationalize(tc.x, tc.limit)
+		assert.Equal(t, []int{tc.num, tc.den}, []int{num, den}, "%v", tc.x)
+	}
+}
+
+func TestNewWithRatio(t *testing.T) {
+	input := make([]int16, 20000)
+	for i := range input {
+		input[i] = int16(10000 * math.Sin(float64(i)/10))
+	}
+
+	resampleWith := func(newResampler func(out *bytes.Buffer) (*resample.Resampler, error)) []int16 {
+		out := new(bytes.Buffer)
+		r, err := newResampler(out)
+		require.NoError(t, err)
+		_, err = r.Write(buffer(t, input).Bytes())
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		return unBuffer[int16](t, out)
+	}
+
+	t.Run("simple ratio", func(t *testing.T) {
+		expected := resampleWith(func(out *bytes.Buffer) (*resample.Resampler, error) {
+			return resample.New(out, resample.FormatInt16, 44100, 16000, 1)
+		})
+		actual := resampleWith(func(out *bytes.Buffer) (*resample.Resampler, error) {
+			r, err := resample.NewWithRatio(out, resample.FormatInt16, 44100, 16000.0/44100, 1)
+			assert.Equal(t, resample.FilterModeMemoized, r.FilterMode())
+			assert.InDelta(t, 16000, r.OutputRate(), 1e-9)
+			return r, err
+		})
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("drift", func(t *testing.T) {
+		actual := resampleWith(func(out *bytes.Buffer) (*resample.Resampler, error) {
+			r, err := resample.NewWithRatio(out, resample.FormatInt16, 44100, 1.000023, 1)
+			assert.Equal(t, resample.FilterModeQuantized, r.FilterMode())
+			assert.InDelta(t, 44100*1.000023, r.OutputRate(), 1e-9)
+			return r, err
+		})
+		require.Len(t, actual, int(math.Ceil(float64(len(input))*1.000023)))
+
+		// the output is the input stretched in time
+		for i := 100; i < len(actual)-100; i++ {
+			x := float64(i) / 1.000023
+			assert.InDelta(t, 10000*math.Sin(x/10), float64(actual[i]), 20, "sample %d", i)
+		}
+	})
+
+	t.Run("rational rates", func(t *testing.T) {
+		expected := resampleWith(func(out *bytes.Buffer) (*resample.Resampler, error) {
+			return resample.New(out, resample.FormatInt16, 1001, 1000, 1)
+		})
+		actual := resampleWith(func(out *bytes.Buffer) (*resample.Resampler, error) {
+			return resample.New(out, resample.FormatInt16, 48048000, 48000000, 1)
+		})
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("long period", func(t *testing.T) {
+		// 9999713/10000000 repeats every 10^7 input frames, blocks must not follow it
+		out := new(bytes.Buffer)
+		r, err := resample.NewWithRatio(out, resample.FormatFloat32, 48000, 0.9999713, 2)
+		require.NoError(t, err)
+		assert.Equal(t, runtime.NumCPU()*1024, resample.BlockFrames(r))
+
+		_, err = r.ReadFrom(bytes.NewReader(make([]byte, 100*2*4)))
+		require.NoError(t, err)
+		assert.Equal(t, 100*2*4, out.Len())
+	})
+}
+
+func TestNewWithRatioErrors(t *testing.T) {
+	for _, ratio := range []float64{0, -1, math.NaN(), math.Inf(1), 1e-9, 1e9} {
+		_, err := resample.NewWithRatio(nil, resample.FormatInt16, 44100, ratio, 1)
+		require.ErrorIs(t, err, resample.ErrInvalidRate)
+	}
+	_, err := resample.NewWithRatio(nil, resample.FormatInt16, 0, 1, 1)
+	require.ErrorIs(t, err, resample.ErrInvalidRate)
+}
+
+func TestSetRates(t *testing.T) {
+	input := make([]float64, 6000)
+	for i := range input {
+		input[i] = math.Sin(float64(i) / 20)
+	}
+
+	t.Run("same rates", func(t *testing.T) {
+		expected, err := resample.ResampleSlice(nil, input, 44100, 16000, 1)
+		require.NoError(t, err)
+
+		s, err := resample.NewSliceResampler[float64](44100, 16000, 1)
+		require.NoError(t, err)
+		actual, err := s.Resample(nil, input[:3001])
+		require.NoError(t, err)
+		require.NoError(t, s.SetRates(44100, 16000))
+		actual, err = s.Resample(actual, input[3001:])
+		require.NoError(t, err)
+
+		assert.Equal(t, expected, s.Flush(actual))
+	})
+
+	// the output is a continuous sine whose time step changes at the first unwritten frame
+	ratios := []struct {
+		name   string
+		change func(s *resample.SliceResampler[float64]) error
+		step   float64
+		mode   resample.FilterMode
+	}{
+		{
+			name:   "upsampling",
+			change: func(s *resample.SliceResampler[float64]) error { return s.SetRates(1, 3) },
+			step:   1.0 / 3,
+			mode:   resample.FilterModeMemoized,
+		},
+		{
+			name:   "downsampling",
+			change: func(s *resample.SliceResampler[float64]) error { return s.SetRates(4, 3) },
+			step:   4.0 / 3,
+			mode:   resample.FilterModeMemoized,
+		},
+		{
+			name:   "drift",
+			change: func(s *resample.SliceResampler[float64]) error { return s.SetRatio(0.9999713) },
+			step:   1 / 0.9999713,
+			mode:   resample.FilterModeQuantized,
+		},
+	}
+	for _, ratio := range ratios {
+		t.Run(ratio.name, func(t *testing.T) {
+			s, err := resample.NewSliceResampler[float64](2, 3, 1)
+			require.NoError(t, err)
+			output, err := s.Resample(nil, input[:3000])
+			require.NoError(t, err)
+			written := len(output)
+
+			require.NoError(t, ratio.change(s))
+			assert.Equal(t, ratio.mode, s.FilterMode())
+			output, err = s.Resample(output, input[3000:])
+			require.NoError(t, err)
+			output = s.Flush(output)
+
+			start := float64(written) * 2 / 3
+			for i := 100; i < len(output)-100; i++ {
+				x := float64(i) * 2 / 3
+				if i >= written {
+					x = start + float64(i-written)*ratio.step
+				}
+				if x > float64(len(input)-100) {
+					break
+				}
+				require.InDelta(t, math.Sin(x/20), output[i], 2e-3, "sample %d", i)
+			}
+		})
+	}
+}
+
+func TestSetRatesStream(t *testing.T) {
+	input := make([]int16, 20000)
+	for i := range input {
+		input[i] = int16(10000 * math.Sin(float64(i)/10))
+	}
+	data := buffer(t, input).Bytes()
+
+	out := new(bytes.Buffer)
+	r, err := resample.New(out, resample.FormatInt16, 48000, 48000, 1)
+	require.NoError(t, err)
+	_, err = r.Write(data[:20000])
+	require.NoError(t, err)
+
+	written := out.Len() / 2
+	require.NoError(t, r.SetRatio(1.5))
+	assert.InDelta(t, 72000, r.OutputRate(), 1e-9)
+	_, err = r.Write(data[20000:])
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+
+	output := unBuffer[int16](t, out)
+	assert.Equal(t, written+(len(input)-written)*3/2, len(output))
+
+	require.ErrorIs(t, r.SetRatio(0), resample.ErrInvalidRate)
+	require.ErrorIs(t, r.SetRates(1, -1), resample.ErrInvalidRate)
+	assert.InDelta(t, 72000, r.OutputRate(), 1e-9)
+}
+
+func TestPositions(t *testing.T) {
+	out := new(bytes.Buffer)
+	r, err := resample.New(out, resample.FormatInt16, 44100, 48000, 1)
+	require.NoError(t, err)
+	assert.Zero(t, r.InputFramesConsumed())
+	assert.Zero(t, r.OutputFramesProduced())
+
+	data := make([]byte, 10000*2+1)
+	for i := 0; i < len(data); i += 999 {
+		_, err = r.Write(data[i:min(i+999, len(data))])
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int64(10000), r.InputFramesConsumed())
+	assert.Equal(t, int64(out.Len()/2), r.OutputFramesProduced())
+
+	assert.Equal(t, 480.0, r.OutputTimeFor(441))
+	assert.Equal(t, 441.0, r.InputTimeFor(480))
+	assert.Equal(t, 0.91875, r.InputTimeFor(1))
+	assert.Equal(t, -480.0, r.OutputTimeFor(-441))
+	for _, frame := range []int64{0, 1, 7, 12345, 1 << 40} {
+		assert.InDelta(t, float64(frame), r.InputTimeFor(frame)*48000/44100, 1e-9*float64(frame+1))
+	}
+
+	// a day of audio does not drift
+	day := int64(24 * 60 * 60)
+	assert.Equal(t, float64(48000*day), r.OutputTimeFor(44100*day))
+	assert.Equal(t, float64(44100*day), r.InputTimeFor(48000*day))
+
+	// the next output frame keeps its position after a rate change
+	next := r.OutputFramesProduced()
+	position := r.InputTimeFor(next)
+	require.NoError(t, r.SetRates(44100, 96000))
+	assert.InDelta(t, position, r.InputTimeFor(next), 1.0/96000)
+	assert.InDelta(t, position+44100.0/96000, r.InputTimeFor(next+1), 1.0/96000)
+	assert.InDelta(t, float64(next), r.OutputTimeFor(int64(math.Round(position))), 96000.0/44100)
+
+	require.ErrorIs(t, r.Flush(), resample.ErrMisalignedInput)
+	assert.Zero(t, r.InputFramesConsumed())
+	assert.Zero(t, r.OutputFramesProduced())
+	assert.Equal(t, 441.0, r.InputTimeFor(960))
+}
+
+func TestPositionsReadFrom(t *testing.T) {
+	out := new(bytes.Buffer)
+	r, err := resample.New(out, resample.FormatInt16, 44100, 48000, 2)
+	require.NoError(t, err)
+
+	// ReadFrom flushes at the end of the reader, which starts a new stream
+	for range 2 {
+		_, err = r.ReadFrom(bytes.NewReader(make([]byte, 44100*2*2)))
+		require.NoError(t, err)
+		assert.Zero(t, r.InputFramesConsumed())
+		assert.Zero(t, r.OutputFramesProduced())
+		assert.Equal(t, 480.0, r.OutputTimeFor(441))
+	}
+	assert.Equal(t, int64(2*44100), r.TotalInputFrames())
+	assert.Equal(t, int64(2*48000), r.TotalOutputFrames())
+	assert.Equal(t, int64(out.Len()/4), r.TotalOutputFrames())
+
+	_, err = r.Write(make([]byte, 441*2*2))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2*44100+441), r.TotalInputFrames())
+	assert.Equal(t, int64(out.Len()/4), r.TotalOutputFrames())
+}
+
+func TestPositionsCascade(t *testing.T) {
+	out := new(bytes.Buffer)
+	r, err := resample.New(out, resample.FormatFloat32, 192000, 8000, 2)
+	require.NoError(t, err)
+
+	_, err = r.Write(make([]byte, 24000*2*4))
+	require.NoError(t, err)
+	assert.Equal(t, int64(24000), r.InputFramesConsumed())
+	assert.Equal(t, int64(out.Len()/8), r.OutputFramesProduced())
+
+	assert.Equal(t, 24.0, r.InputTimeFor(1))
+	assert.Equal(t, 24000.0, r.InputTimeFor(1000))
+	assert.Equal(t, 0.5, r.OutputTimeFor(12))
+	assert.Equal(t, 1000.0, r.OutputTimeFor(24000))
+}
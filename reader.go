@@ -0,0 +1,93 @@
+package resample
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// A Reader is an io.Reader that resamples data read from a source.
+type Reader struct {
+	src io.Reader
+	res *Resampler
+	out bytes.Buffer
+	in  []byte
+	err error
+}
+
+// NewReader creates a new Reader.
+//
+// Calling Reader.Read method on the returned Reader lazily reads
+// just enough data from src to produce the requested amount of output.
+// Data is resampled according to provided format, inRate, outRate and number of channels.
+// The end of src is treated as the end of the stream.
+//
+// Options are the same as in New.
+func NewReader(src io.Reader, format Format, inRate, outRate, ch int,
+	options ...Option) (*Reader, error) {
+	r := &Reader{src: src}
+
+	res, err := New(&r.out, format, inRate, outRate, ch, options...)
+	if err != nil {
+		return nil, err
+	}
+	r.res = res
+	r.in = make([]byte, res.blockFrames()*res.elemSize*res.ch)
+
+	return r, nil
+}
+
+// maxConsecutiveEmptyReads is the number of reads from src returning
+// neither data nor an error after which Read gives up, as in bufio.
+const maxConsecutiveEmptyReads = 100
+
+// Read reads resampled data into p.
+//
+// If src returns neither data nor an error many times in a row,
+// Read returns io.ErrNoProgress.
+func (r *Reader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for empty := 0; r.out.Len() == 0 && r.err == nil; {
+		if r.fill(len(p)) > 0 {
+			empty = 0
+			continue
+		}
+		empty++
+		if empty == maxConsecutiveEmptyReads {
+			return 0, io.ErrNoProgress
+		}
+	}
+	if r.out.Len() > 0 {
+		return r.out.Read(p)
+	}
+	return 0, r.err
+}
+
+// fill reads from src the amount of input needed to produce
+// about size bytes of output, resamples it and returns the number of bytes read.
+func (r *Reader) fill(size int) int {
+	res := r.res
+	frameSize := res.elemSize * res.ch
+	outFrameSize := formatElementSize[res.outFormat] * res.ch
+	frames := (size/outFrameSize*res.inRate + res.outRate - 1) / res.outRate
+	frames = min(max(frames, 1), res.blockFrames())
+
+	n, err := r.src.Read(r.in[:frames*frameSize])
+	if _, resErr := res.Write(r.in[:n]); resErr != nil {
+		r.err = resErr
+		return n
+	}
+
+	switch {
+	case errors.Is(err, io.EOF):
+		r.err = res.Flush()
+		if r.err == nil {
+			r.err = io.EOF
+		}
+	case err != nil:
+		r.err = err
+	}
+	return n
+}
@@ -0,0 +1,92 @@
+package resample_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/gunter-q12/resample"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReader(t *testing.T) {
+	rates := []struct{ ir, or int }{{3, 2}, {2, 3}, {44100, 16000}}
+	sources := []struct {
+		name string
+		wrap func(io.Reader) io.Reader
+	}{
+		{"plain", func(r io.Reader) io.Reader { return r }},
+		{"one byte", iotest.OneByteReader},
+		{"half", iotest.HalfReader},
+		{"data err", iotest.DataErrReader},
+	}
+
+	for _, rate := range rates {
+		for _, frames := range []int{0, 1, 100, 5000} {
+			data, expected := writeReference(t, frames, rate.ir, rate.or, 2, resample.WithKaiserFastestFilter())
+
+			for _, src := range sources {
+				name := fmt.Sprintf("%d->%d %s %d frames", rate.ir, rate.or, src.name, frames)
+				t.Run(name, func(t *testing.T) {
+					r, err := resample.NewReader(src.wrap(bytes.NewReader(data)),
+						resample.FormatInt16, rate.ir, rate.or, 2, resample.WithKaiserFastestFilter())
+					require.NoError(t, err)
+
+					require.NoError(t, iotest.TestReader(r, expected))
+				})
+			}
+		}
+	}
+}
+
+func TestReaderError(t *testing.T) {
+	_, err := resample.NewReader(bytes.NewReader(nil), resample.FormatInt16, 0, 1, 1)
+	require.ErrorIs(t, err, resample.ErrInvalidRate)
+
+	r, err := resample.NewReader(iotest.ErrReader(io.ErrClosedPipe), resample.FormatInt16, 1, 2, 1)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r)
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+// emptyReader returns neither data nor an error and counts reads.
+type emptyReader struct {
+	reads int
+}
+
+func (r *emptyReader) Read([]byte) (int, error) {
+	r.reads++
+	return 0, nil
+}
+
+func TestReaderNoProgress(t *testing.T) {
+	src := &emptyReader{}
+	r, err := resample.NewReader(src, resample.FormatInt16, 1, 2, 1)
+	require.NoError(t, err)
+
+	n, err := r.Read(nil)
+	assert.Zero(t, n)
+	require.NoError(t, err)
+	assert.Zero(t, src.reads)
+
+	_, err = r.Read(make([]byte, 10))
+	require.ErrorIs(t, err, io.ErrNoProgress)
+	assert.Equal(t, 100, src.reads)
+}
+
+func Example_resamplingReader() {
+	input := new(bytes.Buffer)
+	_ = binary.Write(input, binary.LittleEndian, []int16{1, 3, 5})
+
+	r, _ := resample.NewReader(input, resample.FormatInt16, 1, 2, 1, resample.WithLinearFilter())
+
+	output := make([]int16, 6)
+	_ = binary.Read(r, binary.LittleEndian, output)
+
+	fmt.Println(output)
+
+	// Output: [1 2 3 4 5 3]
+}
@@ -2,10 +2,15 @@ package resample
 
 import (
 	"errors"
+	"fmt"
 	"golang.org/x/exp/constraints"
 	"io"
+	"math"
+	"math/rand/v2"
 	"runtime"
 	"slices"
+	"sync/atomic"
+	"time"
 )
 
 const routinesPerCore = 4
@@ -33,16 +38,51 @@ var formatElementSize = map[Format]int{
 	FormatFloat64: 8,
 }
 
+// formatFullScale is a value that corresponds to 1.0 in float formats.
+//
+//nolint:mnd // map used as a constant
+var formatFullScale = map[Format]float64{
+	FormatInt16:   1 << 15,
+	FormatInt32:   1 << 31,
+	FormatInt64:   1 << 63,
+	FormatFloat32: 1,
+	FormatFloat64: 1,
+}
+
 // A Resampler is a struct used for resampling.
 type Resampler struct {
 	outBuf      io.Writer
 	format      Format
-	inRate      int
-	outRate     int
+	outFormat   Format
+	inRate      int     // Input rate reduced by gcd(inRate, outRate)
+	outRate     int     // Output rate reduced by gcd(inRate, outRate)
+	inFreq      float64 // Input sampling rate in Hz
+	decimation  int     // Decimation factor of the multi-stage cascade, 1 for a single stage
 	ch          int
 	memoization bool
+	mode        FilterMode
 	f           *filter
+	fOption     Option  // Option that sets f, reapplied when rates change
+	fRight      *filter // Filter used for the right wing, the same as f for symmetric filters
 	elemSize    int
+	stream      streamer
+	clipped     atomic.Int64
+	realtime    bool // Frames are calculated on the caller's goroutine, see WithRealtime
+
+	genericKernels bool // Dedicated kernels for integer ratios are disabled, used by tests
+
+	delayCompensation bool // Output frames are shifted by the group delay, see WithDelayCompensation
+
+	prevInputFrames  int64 // Input frames of finished streams, see TotalInputFrames
+	prevOutputFrames int64 // Output frames of finished streams, see TotalOutputFrames
+
+	dither       Dither
+	noiseShaping NoiseShaping
+	ditherSeed   uint64
+
+	memoizationLimit int
+	quantized        bool // FilterModeQuantized is forced by WithQuantizedPhases
+	phases           int  // Number of phases used by FilterModeQuantized
 }
 
 // New creates a new Resampler.
@@ -50,34 +90,70 @@ type Resampler struct {
 // Calling Resampler.Write and Resampler.ReadFrom methods on the returned Resampler
 // will resample data according to provided format, inRate, outRate and number of channels.
 // Results are written to the io.Writer.
+// Whenever data reaches the Resampler through Write, including io.Copy from sources
+// that implement io.WriterTo, such as bytes.Buffer and bytes.Reader,
+// Close or Flush must be called at the end of the stream to write its tail.
 //
+// Only the ratio of rates matters, so they may be given in any units,
+// e.g. New(w, format, 1001, 1000, ch) converts from 48048 Hz to 48000 Hz or
+// from 48000 Hz to 47952 Hz (NTSC pull-down). Use NewWithRatio for non-rational ratios.
+// Rates reduced by their greatest common divisor must not exceed 2^32,
+// otherwise ErrInvalidRate is returned.
+//
+// Output is written in the same format as input, use WithOutputFormat to change it.
 // Default filter is KaiserFastFilter, use WithXFilter options to change it.
-// Memoization is enabled by default, use WithNoMemoization function to disable it.
+// Memoization is enabled by default if it fits WithMemoizationLimit,
+// use WithNoMemoization function to disable it.
 func New(outBuffer io.Writer, format Format, inRate, outRate, ch int,
 	options ...Option) (*Resampler, error) {
-	if inRate <= 0 || outRate <= 0 || ch <= 0 {
-		return nil, errors.New("sampling rates and channel number must be greater than zero")
+	if inRate <= 0 || outRate <= 0 {
+		return nil, fmt.Errorf("resampler: new: %w", ErrInvalidRate)
+	}
+	if ch <= 0 {
+		return nil, fmt.Errorf("resampler: new: %w", ErrInvalidChannels)
+	}
+	if _, ok := formatElementSize[format]; !ok {
+		return nil, fmt.Errorf("resampler: new: %w: %d", ErrUnknownFormat, format)
 	}
 
+	g := gcd(inRate, outRate)
+	inRate, outRate = inRate/g, outRate/g
+	if uint64(inRate) > maxReducedRate || uint64(outRate) > maxReducedRate {
+		return nil, fmt.Errorf("resampler: new: %w: ratio %d/%d is too precise", ErrInvalidRate, outRate, inRate)
+	}
 	resampler := &Resampler{
 		outBuf:      outBuffer,
 		format:      format,
+		outFormat:   format,
 		inRate:      inRate,
 		outRate:     outRate,
+		inFreq:      float64(inRate * g),
+		decimation:  chooseDecimation(inRate, outRate),
 		ch:          ch,
 		memoization: true,
 		elemSize:    formatElementSize[format],
+		ditherSeed:  rand.Uint64(), //nolint:gosec // dither needs no crypto
+
+		memoizationLimit: DefaultMemoizationLimit,
+		phases:           DefaultQuantizedPhases,
 	}
 
 	slices.SortFunc(options, optionCmp)
 	for _, option := range options {
+		if option.apply == nil {
+			continue
+		}
 		if err := option.apply(resampler); err != nil {
 			return nil, err
 		}
+		if option.precedence == filterPrecedence {
+			resampler.fOption = option
+		}
 	}
 
 	if resampler.f == nil {
-		if err := WithKaiserFastFilter().apply(resampler); err != nil {
+		resampler.fOption = WithKaiserFastFilter()
+		if err := resampler.fOption.apply(resampler); err != nil {
 			return nil, err
 		}
 	}
@@ -87,93 +163,392 @@ func New(outBuffer io.Writer, format Format, inRate, outRate, ch int,
 
 // Write writes resampled data to an io.Writer provided during a New call.
 //
-// If Write is called multiple times, the data is appended to the same io.Writer.
-// Note that calling Write on separate parts of the same file may result in
-// imperfect resampling at the boundaries. For large files that do not fit
-// into memory, use io.Copy instead.
+// Resampler keeps the filter history between Write calls, so a stream
+// may be passed in parts of arbitrary size and the result
+// is the same as if the whole stream was passed at once.
+// Incomplete samples and frames are kept until the next Write call.
+// Output frames that depend on input that has not been received yet
+// are held back until the next Write call or until a Flush call,
+// so Close or Flush is required at the end of the stream.
 func (r *Resampler) Write(input []byte) (int, error) {
+	s, err := r.streamer()
+	if err != nil {
+		return 0, err
+	}
+	return s.resample(input)
+}
+
+// ReadFrom reads all the data from reader using batching to reduce memory usage.
+//
+// The data read is treated as a continuation of the current stream
+// and the end of the reader as the end of the stream.
+// Short reads are accumulated until a whole batch is read,
+// so ReadFrom may be used with network connections, pipes and other
+// readers that return less data than requested.
+// In real-time mode every read is resampled immediately, see WithRealtime.
+// As required by io.ReaderFrom, io.EOF is not returned as an error.
+//
+// At the end of the reader ReadFrom calls Flush, which ends the stream, so per-stream
+// counters and positions, such as InputFramesConsumed and OutputTimeFor, are reset.
+// Use TotalInputFrames and TotalOutputFrames to get totals.
+func (r *Resampler) ReadFrom(reader io.Reader) (int64, error) {
+	s, err := r.streamer()
+	if err != nil {
+		return 0, err
+	}
+	blockSize := r.blockFrames() * r.elemSize * r.ch
+
+	buff := make([]byte, blockSize)
+	filled := 0
+	var read int64
+
+	for {
+		n, err := reader.Read(buff[filled:])
+		read += int64(n)
+		filled += n
+
+		if filled == blockSize || err != nil || r.realtime {
+			if _, resErr := s.resample(buff[:filled]); resErr != nil {
+				return read, resErr
+			}
+			filled = 0
+		}
+
+		if errors.Is(err, io.EOF) {
+			return read, s.flush()
+		}
+		if err != nil {
+			return read, err
+		}
+	}
+}
+
+// blockFrames returns the number of frames read at once by ReadFrom.
+//
+// The convolver keeps its position between calls, so blocks need not
+// be aligned to the period of the ratio of rates, which may be up to 2^24 frames.
+func (r *Resampler) blockFrames() int {
+	return runtime.NumCPU() * 1024 //nolint:mnd // frames per CPU
+}
+
+// Flush ends the current stream and writes the remaining resampled data.
+//
+// The input after the end of the stream is treated as silence, so the total
+// number of written frames is ceil(inFrames*outRate/inRate).
+// If the stream ends with an incomplete frame, it is discarded
+// and ErrMisalignedInput is returned.
+// After Flush the Resampler may be used to resample a new stream.
+func (r *Resampler) Flush() error {
+	s, err := r.streamer()
+	if err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+// Close is equivalent to Flush and makes Resampler an io.WriteCloser.
+//
+// Close does not close the io.Writer provided during a New call.
+func (r *Resampler) Close() error {
+	return r.Flush()
+}
+
+// SetRates changes input and output rates of the current stream.
+//
+// The change takes effect at the next output frame that has not been written yet,
+// including frames held back until more input is received. The position of that
+// frame in the input is preserved, so the output has no phase discontinuity.
+// Window scaling depends on the ratio continuously, so gradual ratio changes
+// are smooth when crossing between upsampling and downsampling.
+// If the new filter covers more input frames than the previous one,
+// its first output frames see the history older than the previous filter covered as silence.
+// The multi-stage cascade chosen by New is kept, so ErrInvalidRate is returned
+// if the new ratio is lower than 2 times its decimation factor, see WithSingleStage.
+//
+// SetRates must not be called concurrently with other methods.
+func (r *Resampler) SetRates(inRate, outRate int) error {
+	if inRate <= 0 || outRate <= 0 {
+		return fmt.Errorf("resampler: set rates: %w", ErrInvalidRate)
+	}
+
+	inFreq := r.inFreq
+	r.inFreq = float64(inRate)
+	if err := r.setRates(inRate, outRate); err != nil {
+		r.inFreq = inFreq
+		return err
+	}
+	return nil
+}
+
+// SetRatio changes the output rate of the current stream to inRate*ratio.
+//
+// The ratio is approximated in the same way as in NewWithRatio.
+// Otherwise, SetRatio is the same as SetRates.
+func (r *Resampler) SetRatio(ratio float64) error {
+	if math.IsNaN(ratio) || ratio < 1.0/maxRatioTerm || ratio > maxRatioTerm {
+		return fmt.Errorf("resampler: set ratio: %w: %v", ErrInvalidRate, ratio)
+	}
+	num, den := rationalize(ratio, maxRatioTerm)
+	return r.setRates(den, num)
+}
+
+// setRates changes the ratio of rates and rebuilds the filter for it.
+func (r *Resampler) setRates(inRate, outRate int) error {
+	prev := struct {
+		inRate, outRate int
+		mode            FilterMode
+		f, fRight       *filter
+	}{r.inRate, r.outRate, r.mode, r.f, r.fRight}
+
+	g := gcd(inRate, outRate)
+	if uint64(inRate/g) > maxReducedRate || uint64(outRate/g) > maxReducedRate {
+		return fmt.Errorf("resampler: set rates: %w: ratio %d/%d is too precise", ErrInvalidRate, outRate/g, inRate/g)
+	}
+	if r.decimation > 1 && inRate/outRate/r.decimation < minStageRatio {
+		return fmt.Errorf("resampler: set rates: %w: ratio is too low for the multi-stage cascade", ErrInvalidRate)
+	}
+
+	r.inRate, r.outRate = inRate/g, outRate/g
+	if err := r.fOption.apply(r); err != nil {
+		r.inRate, r.outRate, r.mode, r.f, r.fRight = prev.inRate, prev.outRate, prev.mode, prev.f, prev.fRight
+		return fmt.Errorf("resampler: set rates: %w", err)
+	}
+
+	if r.stream != nil {
+		r.stream.retime()
+	}
+	return nil
+}
+
+// maxReducedRate limits reduced rates, so products of stream positions
+// and rates used by the convolver do not overflow.
+const maxReducedRate uint64 = 1 << 32
+
+// minStageRatio is the minimal ratio of rates of the last stage of the multi-stage cascade.
+const minStageRatio = 2
+
+// chooseDecimation returns a decimation factor of the multi-stage cascade for given rates.
+//
+// The input is decimated by 2 until the ratio of the last stage is in the [2, 4) range,
+// since downsampling by a ratio of k makes the filter k times longer.
+// Decimation stages have wide transition bands, so their filters are short.
+func chooseDecimation(inRate, outRate int) int {
+	d := 1
+	for inRate/outRate/d >= 2*minStageRatio { // division avoids overflows for huge ratios
+		d *= 2
+	}
+	return d
+}
+
+// stageRates returns reduced input and output rates of the last stage of the multi-stage cascade.
+func (r *Resampler) stageRates() (int, int) {
+	outRate := r.outRate * r.decimation
+	g := gcd(r.inRate, outRate)
+	return r.inRate / g, outRate / g
+}
+
+// OutputRate returns the output sampling rate in Hz.
+//
+// For resamplers created by NewWithRatio it reflects
+// the rational approximation of the ratio actually used.
+func (r *Resampler) OutputRate() float64 {
+	return r.inFreq * float64(r.outRate) / float64(r.inRate)
+}
+
+// Latency returns the number of input frames that must follow an input position
+// before the output frames located at it are written, and the same amount in output frames,
+// rounded up.
+//
+// It equals the right wing of the filter, and is constant for the stream
+// unless SetRates changes the filter. With the multi-stage cascade, the wings of
+// decimation stages are added, and stages may hold back a few more frames,
+// since they emit frames in steps of their decimation factors.
+// Write calls and Flush are not delayed otherwise, while ReadFrom accumulates
+// input in batches unless WithRealtime is used.
+func (r *Resampler) Latency() (int, int) {
+	inFrames := r.fRight.Length(0) * r.decimation
+	for stage := 1; stage < r.decimation; stage *= 2 {
+		inFrames += decimationInfo(r.decimation/stage/2).wing(2, 1) * stage //nolint:mnd // each stage halves the rate
+	}
+	if r.delayCompensation {
+		inFrames += int(math.Ceil(max(0, r.groupDelay()) * float64(r.decimation)))
+	}
+	outFrames := (inFrames*r.outRate + r.inRate - 1) / r.inRate
+	return inFrames, outFrames
+}
+
+// InputFramesConsumed returns the number of whole input frames
+// received since the start of the current stream.
+//
+// Flush starts a new stream and resets the counter.
+func (r *Resampler) InputFramesConsumed() int64 {
+	s, err := r.streamer()
+	if err != nil {
+		return 0
+	}
+	consumed, _ := s.frames()
+	return consumed
+}
+
+// OutputFramesProduced returns the number of output frames
+// written since the start of the current stream.
+//
+// Flush starts a new stream and resets the counter.
+func (r *Resampler) OutputFramesProduced() int64 {
+	s, err := r.streamer()
+	if err != nil {
+		return 0
+	}
+	_, produced := s.frames()
+	return produced
+}
+
+// TotalInputFrames returns the number of whole input frames received by the Resampler
+// in all the streams, it is not reset by Flush.
+func (r *Resampler) TotalInputFrames() int64 {
+	return r.prevInputFrames + r.InputFramesConsumed()
+}
+
+// TotalOutputFrames returns the number of output frames written by the Resampler
+// in all the streams, it is not reset by Flush.
+func (r *Resampler) TotalOutputFrames() int64 {
+	return r.prevOutputFrames + r.OutputFramesProduced()
+}
+
+// OutputTimeFor returns the position of an input frame of the current stream
+// in output frames, e.g. 1.5 means the middle between the second and the third output frames.
+//
+// Output frame k is located at the input position InputTimeFor(k),
+// and the functions are inverse of each other.
+// Positions are calculated exactly from the ratio of rates, so they do not drift
+// over long streams. After SetRates, positions of all frames are calculated
+// with the new rates from the position of the next output frame,
+// so positions of frames written before the change are extrapolated.
+// The shift of WithDelayCompensation is included.
+// Multiply the result by the duration of an output frame to get a timestamp.
+func (r *Resampler) OutputTimeFor(inputFrame int64) float64 {
+	s, err := r.streamer()
+	if err != nil {
+		return math.NaN()
+	}
+	return s.outputPosition(inputFrame)
+}
+
+// InputTimeFor returns the position of an output frame of the current stream in input frames,
+// see OutputTimeFor.
+func (r *Resampler) InputTimeFor(outputFrame int64) float64 {
+	s, err := r.streamer()
+	if err != nil {
+		return math.NaN()
+	}
+	return s.inputPosition(outputFrame)
+}
+
+// GroupDelay is a delay of the signal caused by the filter.
+type GroupDelay struct {
+	InputFrames  float64
+	OutputFrames float64
+	Time         time.Duration // Assumes that the input rate is given in Hz
+}
+
+// Delay returns the group delay of the filter at low frequencies,
+// i.e. how much later than the input signal its features appear in the output.
+//
+// Output frame k is calculated at the input position k*inRate/outRate with the filter
+// centered at it, so symmetric filters, including all the built-in ones, have zero delay,
+// and output frames are aligned with the input without compensation.
+// Asymmetric filters set by WithFilter, such as minimum-phase ones, delay
+// the signal by the centroid of their impulse response.
+// Positive delays are compensated by WithDelayCompensation.
+func (r *Resampler) Delay() GroupDelay {
+	inFrames := r.groupDelay() * float64(r.decimation)
+	return GroupDelay{
+		InputFrames:  inFrames,
+		OutputFrames: inFrames * float64(r.outRate) / float64(r.inRate),
+		Time:         time.Duration(inFrames / r.inFreq * float64(time.Second)),
+	}
+}
+
+// groupDelay returns the group delay of the filter in input frames of the last stage.
+func (r *Resampler) groupDelay() float64 {
+	if r.f == r.fRight {
+		return 0
+	}
+	leftWeight, leftMoment := r.f.moments()
+	rightWeight, rightMoment := r.fRight.moments()
+	return (leftMoment - rightMoment) / (leftWeight + rightWeight)
+}
+
+// FilterMode returns a mode of evaluating filter values chosen during a New call.
+func (r *Resampler) FilterMode() FilterMode {
+	return r.mode
+}
+
+// Clipped returns the number of output samples that did not fit
+// into the range of an integer format and were saturated.
+//
+// Clipping may occur when a near full-scale signal overshoots
+// after filtering. The counter is not reset by Flush.
+func (r *Resampler) Clipped() int64 {
+	return r.clipped.Load()
+}
+
+// streamer returns a convolver of the current stream creating it if necessary.
+func (r *Resampler) streamer() (streamer, error) {
+	if r.stream != nil {
+		return r.stream, nil
+	}
+
+	var err error
 	switch r.format {
 	case FormatInt16:
-		return write[int16](r, input)
+		r.stream, err = newStreamer[int16](r)
 	case FormatInt32:
-		return write[int32](r, input)
+		r.stream, err = newStreamer[int32](r)
 	case FormatInt64:
-		return write[int64](r, input)
+		r.stream, err = newStreamer[int64](r)
 	case FormatFloat32:
-		return write[float32](r, input)
+		r.stream, err = newStreamer[float32](r)
 	case FormatFloat64:
-		return write[float64](r, input)
+		r.stream, err = newStreamer[float64](r)
 	default:
-		panic("unknown format")
+		err = fmt.Errorf("resampler: %w: %d", ErrUnknownFormat, r.format)
 	}
+	return r.stream, err
 }
 
-// ReadFrom reads all the data from reader using batching to reduce memory usage.
-func (r *Resampler) ReadFrom(reader io.Reader) (int64, error) {
-	switch r.format {
+// newStreamer returns a convolver with I input type and output type defined by outFormat.
+func newStreamer[I number](r *Resampler) (streamer, error) {
+	switch r.outFormat {
 	case FormatInt16:
-		return readFrom[int16](r, reader)
+		return asStreamer(newConvolver[I, int16](r))
 	case FormatInt32:
-		return readFrom[int32](r, reader)
+		return asStreamer(newConvolver[I, int32](r))
 	case FormatInt64:
-		return readFrom[int64](r, reader)
+		return asStreamer(newConvolver[I, int64](r))
 	case FormatFloat32:
-		return readFrom[float32](r, reader)
+		return asStreamer(newConvolver[I, float32](r))
 	case FormatFloat64:
-		return readFrom[float64](r, reader)
+		return asStreamer(newConvolver[I, float64](r))
 	default:
-		panic("unknown format")
+		return nil, fmt.Errorf("resampler: %w: %d", ErrUnknownFormat, r.outFormat)
 	}
 }
 
-// write is an actual implementation of Resampler.Write.
-func write[T number](r *Resampler, input []byte) (int, error) {
-	c := newConvolver[T](r, len(input))
-	return c.resample(input, 0, len(input))
-}
-
-// readFrom is an actual implementation of Resampler.ReadFrom.
-func readFrom[T number](r *Resampler, reader io.Reader) (int64, error) {
-	wingSize := r.f.Length(0) * r.elemSize
-	middleSize := (runtime.NumCPU()*1024 + r.inRate - 1) / r.inRate * r.inRate
-	buffSize := wingSize*3 + middleSize*r.elemSize //nolint:mnd // math
-
-	buff := make([]byte, buffSize)
-	c := newConvolver[T](r, buffSize)
-	read := 0
-
-	n, err := reader.Read(buff[:middleSize+wingSize])
-	read += n
-	if err != nil && errors.Is(err, io.EOF) {
-		return int64(read), err
-	}
-	if n < middleSize+wingSize {
-		_, err = c.resample(buff[:n], 0, n)
-		return int64(read), err
-	}
-
-	// Special case for the first part
-	_, err = c.resample(buff[:middleSize], 0, middleSize)
+// asStreamer returns a convolver created by newConvolver as a streamer.
+//
+// It avoids a non-nil streamer holding a nil convolver in case of an error.
+func asStreamer[I, O number](c *convolver[I, O], err error) (streamer, error) {
 	if err != nil {
-		return int64(read), err
+		return nil, err
 	}
-	_ = copy(buff[:wingSize*2], buff[middleSize-wingSize:middleSize+wingSize])
-
-	for {
-		n, err = reader.Read(buff[wingSize*2 : wingSize*2+middleSize])
-		read += n
-		if err != nil && errors.Is(err, io.EOF) {
-			return int64(read), err
-		}
-		if n < middleSize {
-			_, err = c.resample(buff[0:wingSize*2+n], wingSize, wingSize*2+n)
-			return int64(read), err
-		}
+	return c, nil
+}
 
-		_, err = c.resample(buff[0:wingSize*2+middleSize], wingSize, wingSize+middleSize)
-		if err != nil {
-			return int64(read), err
-		}
-		_ = copy(buff[:wingSize*2], buff[middleSize:middleSize+wingSize*2])
-	}
+// gain returns a multiplier that converts samples from the input format
+// to the output format.
+//
+// Integer samples are mapped to the [-1, 1) range when converted to float formats and back.
+func (r *Resampler) gain() float64 {
+	return formatFullScale[r.outFormat] / formatFullScale[r.format]
 }
@@ -3,15 +3,19 @@ package resample_test
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/gunter-q12/resample"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/constraints"
 	"io"
+	"math"
 	"os"
 	"reflect"
+	"strconv"
 	"testing"
+	"testing/iotest"
 )
 
 type number interface {
@@ -63,6 +67,86 @@ func TestResamplerInt(t *testing.T) {
 	}
 }
 
+func TestErrors(t *testing.T) {
+	_, err := resample.New(io.Discard, resample.FormatInt16, 0, 1, 1)
+	require.ErrorIs(t, err, resample.ErrInvalidRate)
+	_, err = resample.New(io.Discard, resample.FormatInt16, 1, -1, 1)
+	require.ErrorIs(t, err, resample.ErrInvalidRate)
+	_, err = resample.New(io.Discard, resample.FormatInt16, 1, 1, 0)
+	require.ErrorIs(t, err, resample.ErrInvalidChannels)
+	_, err = resample.New(io.Discard, resample.Format(-1), 1, 1, 1)
+	require.ErrorIs(t, err, resample.ErrUnknownFormat)
+	_, err = resample.New(io.Discard, resample.FormatFloat64+1, 1, 1, 1)
+	require.ErrorIs(t, err, resample.ErrUnknownFormat)
+	_, err = resample.New(io.Discard, resample.FormatInt16, 1, 1, 1, resample.Option{})
+	require.NoError(t, err)
+
+	t.Run("huge ratio", func(t *testing.T) {
+		if strconv.IntSize == 32 {
+			t.Skip("reduced rates cannot exceed the limit on 32-bit platforms")
+		}
+		_, err := resample.New(io.Discard, resample.FormatInt16, math.MaxInt, 1, 1)
+		require.ErrorIs(t, err, resample.ErrInvalidRate)
+		_, err = resample.New(io.Discard, resample.FormatInt16, 1, math.MaxInt, 1)
+		require.ErrorIs(t, err, resample.ErrInvalidRate)
+
+		outBuf := new(bytes.Buffer)
+		maxRate := 1 << (strconv.IntSize / 2) // 1 << 32 on 64-bit platforms
+		res, err := resample.New(outBuf, resample.FormatInt16, maxRate, 1, 1)
+		require.NoError(t, err)
+		_, err = res.Write(buffer(t, []int16{1, 2, 3}).Bytes())
+		require.NoError(t, err)
+		require.NoError(t, res.Close())
+		assert.Equal(t, 2, outBuf.Len())
+		require.ErrorIs(t, res.SetRates(math.MaxInt, 1), resample.ErrInvalidRate)
+	})
+	t.Run("misaligned write", func(t *testing.T) {
+		outBuf := new(bytes.Buffer)
+		res, err := resample.New(outBuf, resample.FormatInt16, 1, 1, 2, resample.WithLinearFilter())
+		require.NoError(t, err)
+
+		n, err := res.Write(buffer(t, []int16{1, 2, 3}).Bytes())
+		require.NoError(t, err)
+		assert.Equal(t, 6, n)
+		require.ErrorIs(t, res.Close(), resample.ErrMisalignedInput)
+		assert.Equal(t, []int16{1, 2}, unBuffer[int16](t, outBuf))
+	})
+	t.Run("misaligned read from", func(t *testing.T) {
+		res, err := resample.New(io.Discard, resample.FormatInt16, 1, 1, 2)
+		require.NoError(t, err)
+
+		_, err = res.ReadFrom(bytes.NewReader(make([]byte, 7)))
+		require.ErrorIs(t, err, resample.ErrMisalignedInput)
+	})
+	t.Run("misaligned reader", func(t *testing.T) {
+		r, err := resample.NewReader(bytes.NewReader(make([]byte, 7)), resample.FormatInt16, 1, 1, 2)
+		require.NoError(t, err)
+
+		_, err = io.ReadAll(r)
+		require.ErrorIs(t, err, resample.ErrMisalignedInput)
+	})
+}
+
+func TestPartialFrames(t *testing.T) {
+	data, expected := writeReference(t, 1000, 3, 2, 3)
+
+	for _, size := range []int{1, 3, 5, 7, 1001} {
+		t.Run(fmt.Sprintf("buffer of %d bytes", size), func(t *testing.T) {
+			actual := new(bytes.Buffer)
+			res, err := resample.New(actual, resample.FormatInt16, 3, 2, 3)
+			require.NoError(t, err)
+
+			// hiding ReadFrom and WriteTo forces io.CopyBuffer to use the buffer
+			_, err = io.CopyBuffer(struct{ io.Writer }{res}, struct{ io.Reader }{bytes.NewReader(data)},
+				make([]byte, size))
+			require.NoError(t, err)
+			require.NoError(t, res.Close())
+
+			assert.Equal(t, expected, actual.Bytes())
+		})
+	}
+}
+
 func TestIOCopy(t *testing.T) {
 	t.Run("small", func(t *testing.T) {
 		outBuf := new(bytes.Buffer)
@@ -71,10 +155,11 @@ func TestIOCopy(t *testing.T) {
 
 		inBuf := buffer(t, []int16{1, 3, 5})
 		_, err = io.Copy(res, inBuf)
-
 		require.NoError(t, err)
+		require.NoError(t, res.Close())
+
 		output := unBuffer[int16](t, outBuf)
-		assert.Equal(t, []int16{1, 2, 3, 4, 5}, output[:5])
+		assert.Equal(t, []int16{1, 2, 3, 4, 5, 3}, output)
 	})
 	t.Run("run twice", func(t *testing.T) {
 		outBuf := new(bytes.Buffer)
@@ -84,15 +169,198 @@ func TestIOCopy(t *testing.T) {
 		inBuf := buffer(t, []int16{1, 3, 5})
 		_, err = io.Copy(res, inBuf)
 		require.NoError(t, err)
+		require.NoError(t, res.Close())
 
 		inBuf = buffer(t, []int16{1, 3, 5})
 		_, err = io.Copy(res, inBuf)
 		require.NoError(t, err)
+		require.NoError(t, res.Close())
 
 		output := unBuffer[int16](t, outBuf)
-		t.Log(output)
-		assert.Equal(t, []int16{1, 2, 3, 4, 5}, output[:5])
-		assert.Equal(t, []int16{1, 2, 3, 4, 5}, output[6:11])
+		assert.Equal(t, []int16{1, 2, 3, 4, 5, 3, 1, 2, 3, 4, 5, 3}, output)
+	})
+	t.Run("writer to", func(t *testing.T) {
+		// bytes.Reader implements io.WriterTo, so io.Copy uses Write and Close writes the tail
+		input := make([]int16, 1000)
+		for i := range input {
+			input[i] = int16(i * 7 % 1000)
+		}
+
+		expected := new(bytes.Buffer)
+		res, err := resample.New(expected, resample.FormatInt16, 3, 2, 1)
+		require.NoError(t, err)
+		_, err = res.ReadFrom(reader{buffer(t, input)})
+		require.NoError(t, err)
+
+		actual := new(bytes.Buffer)
+		res, err = resample.New(actual, resample.FormatInt16, 3, 2, 1)
+		require.NoError(t, err)
+		_, err = io.Copy(res, bytes.NewReader(buffer(t, input).Bytes()))
+		require.NoError(t, err)
+		require.NoError(t, res.Close())
+
+		assert.Equal(t, expected.Bytes(), actual.Bytes())
+	})
+}
+
+func TestReadFromEndOfStream(t *testing.T) {
+	probe, err := resample.New(io.Discard, resample.FormatInt16, 3, 2, 2, resample.WithKaiserFastestFilter())
+	require.NoError(t, err)
+	block := resample.BlockFrames(probe)
+	wing := resample.WingFrames(probe)
+
+	var lengths []int
+	for _, base := range []int{0, block, 2 * block, 3 * block} {
+		for _, wings := range []int{0, 1, 2, 3} {
+			for _, d := range []int{-1, 0, 1} {
+				if frames := base + wings*wing + d; frames >= 0 {
+					lengths = append(lengths, frames)
+				}
+			}
+		}
+	}
+
+	for _, frames := range lengths {
+		t.Run(fmt.Sprintf("%d frames", frames), func(t *testing.T) {
+			data, expected := writeReference(t, frames, 3, 2, 2, resample.WithKaiserFastestFilter())
+
+			actual := new(bytes.Buffer)
+			res, err := resample.New(actual, resample.FormatInt16, 3, 2, 2, resample.WithKaiserFastestFilter())
+			require.NoError(t, err)
+			n, err := res.ReadFrom(bytes.NewReader(data))
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(data)), n)
+
+			assert.Equal(t, expected, actual.Bytes())
+		})
+	}
+}
+
+func TestReadFromShortReads(t *testing.T) {
+	probe, err := resample.New(io.Discard, resample.FormatInt16, 3, 2, 2, resample.WithKaiserFastestFilter())
+	require.NoError(t, err)
+	block := resample.BlockFrames(probe)
+
+	readers := []struct {
+		name string
+		wrap func(io.Reader) io.Reader
+	}{
+		{"one byte", iotest.OneByteReader},
+		{"half", iotest.HalfReader},
+		{"data err", iotest.DataErrReader},
+		{"timeout", iotest.TimeoutReader},
+	}
+
+	for _, frames := range []int{0, 1, 100, block - 1, block, 2*block + 3} {
+		data, expected := writeReference(t, frames, 3, 2, 2, resample.WithKaiserFastestFilter())
+
+		for _, rd := range readers {
+			t.Run(fmt.Sprintf("%s %d frames", rd.name, frames), func(t *testing.T) {
+				actual := new(bytes.Buffer)
+				res, err := resample.New(actual, resample.FormatInt16, 3, 2, 2, resample.WithKaiserFastestFilter())
+				require.NoError(t, err)
+
+				input := rd.wrap(bytes.NewReader(data))
+				n, err := res.ReadFrom(input)
+				if errors.Is(err, iotest.ErrTimeout) {
+					var m int64
+					m, err = res.ReadFrom(input)
+					n += m
+				}
+				require.NoError(t, err)
+				assert.Equal(t, int64(len(data)), n)
+
+				assert.Equal(t, expected, actual.Bytes())
+			})
+		}
+	}
+}
+
+func TestRounding(t *testing.T) {
+	outBuf := new(bytes.Buffer)
+	res, err := resample.New(outBuf, resample.FormatInt16, 1, 2, 1, resample.WithLinearFilter())
+	require.NoError(t, err)
+
+	_, err = res.Write(buffer(t, []int16{1, 2, -1, -2}).Bytes())
+	require.NoError(t, err)
+	require.NoError(t, res.Close())
+
+	output := unBuffer[int16](t, outBuf)
+	assert.Equal(t, []int16{1, 2, 2, 1, -1, -2, -2, -1}, output)
+}
+
+func TestSaturation(t *testing.T) {
+	square := func(hi, lo int16) []int16 {
+		input := make([]int16, 4410)
+		for i := range input {
+			input[i] = hi
+			if i/50%2 == 1 {
+				input[i] = lo
+			}
+		}
+		return input
+	}
+	signals := []struct {
+		name  string
+		input []int16
+	}{
+		{"full scale", square(math.MaxInt16, math.MinInt16)},
+		{"positive", square(math.MaxInt16, 0)},
+	}
+
+	for _, sig := range signals {
+		t.Run(sig.name, func(t *testing.T) {
+			outBuf := new(bytes.Buffer)
+			res, err := resample.New(outBuf, resample.FormatInt16, 44100, 48000, 1)
+			require.NoError(t, err)
+
+			_, err = res.Write(buffer(t, sig.input).Bytes())
+			require.NoError(t, err)
+			require.NoError(t, res.Close())
+			output := unBuffer[int16](t, outBuf)
+
+			assert.Positive(t, res.Clipped())
+			assert.Contains(t, output, int16(math.MaxInt16))
+
+			// in the middle of each half-period output must follow input sign
+			for i := 25; i < len(sig.input)-50; i += 50 {
+				out := output[i*48000/44100]
+				if sig.input[i] > 0 {
+					assert.Greater(t, out, int16(math.MaxInt16/2))
+				} else {
+					assert.Less(t, out, int16(math.MaxInt16/2))
+				}
+			}
+		})
+	}
+}
+
+func TestSaturationTypes(t *testing.T) {
+	t.Run("uint8", func(t *testing.T) {
+		input := make([]uint8, 1000)
+		for i := range input {
+			input[i] = uint8(i / 20 % 2 * math.MaxUint8)
+		}
+		s, err := resample.NewSliceResampler[uint8](3, 4, 1)
+		require.NoError(t, err)
+		_, err = s.Resample(nil, input)
+		require.NoError(t, err)
+		assert.Positive(t, s.Clipped())
+	})
+	t.Run("int64", func(t *testing.T) {
+		input := make([]int64, 1000)
+		for i := range input {
+			input[i] = math.MaxInt64
+			if i/20%2 == 1 {
+				input[i] = math.MinInt64
+			}
+		}
+		output, err := resample.ResampleSlice(nil, input, 3, 4, 1)
+		require.NoError(t, err)
+		assert.Contains(t, output, int64(math.MaxInt64))
+		assert.Contains(t, output, int64(math.MinInt64))
+		assert.Greater(t, output[10*4/3], int64(0))
+		assert.Less(t, output[30*4/3], int64(0))
 	})
 }
 
@@ -182,6 +450,9 @@ func check[T number](t *testing.T, nameSuffix string, tc testCase[T],
 		require.NoError(t, err)
 
 		_, err = res.Write(buffer(t, tc.input).Bytes())
+		if err == nil {
+			err = res.Close()
+		}
 
 		if tc.err != nil {
 			assert.Error(t, err)
@@ -203,6 +474,7 @@ func checkIOCopy[T number](t *testing.T, nameSuffix string, tc testCase[T],
 		n, err := io.Copy(res, reader{buffer(t, tc.input)})
 		assert.Equal(t, len(tc.input)*formatElementSize[tc.format], int(n))
 		require.NoError(t, err)
+		err = res.Close()
 
 		if tc.err != nil {
 			assert.Error(t, err)
@@ -222,9 +494,287 @@ func FuzzResampler(f *testing.F) {
 		}
 		_, err = res.Write(data)
 		if err != nil {
-			t.Error()
+			t.Error(err)
+		}
+	})
+}
+
+func TestOutputLength(t *testing.T) {
+	rates := []struct{ ir, or int }{
+		{1, 1}, {1, 2}, {2, 1}, {3, 4}, {4, 3},
+		{44100, 16000}, {16000, 44100}, {8000, 125}, {125, 8000}, {192000, 8000},
+	}
+	for _, rate := range rates {
+		for _, frames := range []int{0, 1, 2, 5, 99, 1000, 4567} {
+			for _, chunk := range []int{1, 7, 1000} {
+				name := fmt.Sprintf("%d->%d %d frames by %d", rate.ir, rate.or, frames, chunk)
+				t.Run(name, func(t *testing.T) {
+					outBuf := new(bytes.Buffer)
+					res, err := resample.New(outBuf, resample.FormatInt16, rate.ir, rate.or, 2,
+						resample.WithKaiserFastestFilter())
+					require.NoError(t, err)
+
+					data := make([]byte, frames*2*2)
+					for len(data) > 0 {
+						n := min(chunk*2*2, len(data))
+						_, err = res.Write(data[:n])
+						require.NoError(t, err)
+						data = data[n:]
+					}
+					require.NoError(t, res.Close())
+
+					expected := (frames*rate.or + rate.ir - 1) / rate.ir
+					assert.Equal(t, expected*2*2, outBuf.Len())
+				})
+			}
+		}
+	}
+}
+
+func TestFlushStartsNewStream(t *testing.T) {
+	outBuf := new(bytes.Buffer)
+	res, err := resample.New(outBuf, resample.FormatInt16, 1, 2, 1, resample.WithLinearFilter())
+	require.NoError(t, err)
+
+	for range 2 {
+		_, err = res.Write(buffer(t, []int16{1, 3, 5}).Bytes())
+		require.NoError(t, err)
+		require.NoError(t, res.Flush())
+	}
+
+	output := unBuffer[int16](t, outBuf)
+	assert.Equal(t, []int16{1, 2, 3, 4, 5, 3, 1, 2, 3, 4, 5, 3}, output)
+}
+
+func TestIntegerRatios(t *testing.T) {
+	input := make([]float64, 2*5000)
+	for i := range input {
+		input[i] = math.Sin(float64(i)/20) + 0.3*math.Sin(float64(i)/3)
+	}
+
+	rates := []struct{ ir, or int }{{2, 1}, {3, 1}, {48000, 16000}, {1, 2}, {1, 3}, {8000, 48000}, {1, 1}}
+	for _, rate := range rates {
+		t.Run(fmt.Sprintf("%d->%d", rate.ir, rate.or), func(t *testing.T) {
+			expected, err := resample.ResampleSlice(nil, input, rate.ir, rate.or, 2, resample.WithNoMemoization())
+			require.NoError(t, err)
+
+			generic, err := resample.ResampleSlice(nil, input, rate.ir, rate.or, 2, resample.WithGenericKernels())
+			require.NoError(t, err)
+			require.Len(t, generic, len(expected))
+			for i := range generic {
+				require.InDelta(t, generic[i], expected[i], 1e-9, "sample %d", i)
+			}
+
+			s, err := resample.NewSliceResampler[float64](rate.ir, rate.or, 2)
+			require.NoError(t, err)
+			var output []float64
+			for chunk := input; len(chunk) > 0; {
+				n := min(2*333, len(chunk))
+				output, err = s.Resample(output, chunk[:n])
+				require.NoError(t, err)
+				chunk = chunk[n:]
+			}
+			output = s.Flush(output)
+
+			require.Len(t, output, len(expected))
+			for i := range output {
+				require.InDelta(t, expected[i], output[i], 1e-9, "sample %d", i)
+			}
+		})
+	}
+}
+
+func TestMultiStage(t *testing.T) {
+	const inRate, outRate = 192000, 8000
+	tone := func(freq float64) []float64 {
+		input := make([]float64, 48000)
+		for i := range input {
+			input[i] = math.Sin(2 * math.Pi * freq * float64(i) / inRate)
+		}
+		return input
+	}
+
+	t.Run("passband", func(t *testing.T) {
+		input := tone(1000)
+		multi, err := resample.ResampleSlice(nil, input, inRate, outRate, 1)
+		require.NoError(t, err)
+		single, err := resample.ResampleSlice(nil, input, inRate, outRate, 1, resample.WithSingleStage())
+		require.NoError(t, err)
+
+		require.Len(t, multi, len(single))
+		for i := 100; i < len(multi)-100; i++ {
+			assert.InDelta(t, single[i], multi[i], 1e-3, "frame %d", i)
+		}
+	})
+
+	t.Run("aliasing", func(t *testing.T) {
+		// frequencies between the output Nyquist frequency and the input one must be removed
+		for _, freq := range []float64{5000, 12000, 30000, 90000} {
+			output, err := resample.ResampleSlice(nil, tone(freq), inRate, outRate, 1)
+			require.NoError(t, err)
+			for i := 100; i < len(output)-100; i++ {
+				require.InDelta(t, 0, output[i], 1e-3, "%v Hz, frame %d", freq, i)
+			}
 		}
 	})
+
+	t.Run("chunking", func(t *testing.T) {
+		input := tone(1000)
+		expected, err := resample.ResampleSlice(nil, input, inRate, outRate, 1)
+		require.NoError(t, err)
+
+		s, err := resample.NewSliceResampler[float64](inRate, outRate, 1)
+		require.NoError(t, err)
+		var output []float64
+		for chunk := input; len(chunk) > 0; {
+			n := min(777, len(chunk))
+			output, err = s.Resample(output, chunk[:n])
+			require.NoError(t, err)
+			chunk = chunk[n:]
+		}
+		output = s.Flush(output)
+		assert.Equal(t, expected, output)
+	})
+
+	t.Run("set rates", func(t *testing.T) {
+		r, err := resample.New(io.Discard, resample.FormatFloat64, inRate, outRate, 1)
+		require.NoError(t, err)
+		require.NoError(t, r.SetRates(inRate, 12000))
+		require.ErrorIs(t, r.SetRates(inRate, 48000), resample.ErrInvalidRate)
+		assert.InDelta(t, 12000, r.OutputRate(), 1e-9)
+
+		r, err = resample.New(io.Discard, resample.FormatFloat64, inRate, outRate, 1, resample.WithSingleStage())
+		require.NoError(t, err)
+		require.NoError(t, r.SetRates(inRate, 48000))
+	})
+}
+
+func TestRealtime(t *testing.T) {
+	rates := []struct{ ir, or int }{{48000, 8000}, {48000, 16000}, {44100, 48000}, {48000, 44100}}
+	input := make([]int16, 2*48000)
+	for i := range input {
+		input[i] = int16(10000 * math.Sin(float64(i)/30))
+	}
+	data := buffer(t, input).Bytes()
+	const block = 480 * 2 * 2 // 10 ms of stereo int16 at 48 kHz
+
+	for _, rate := range rates {
+		t.Run(fmt.Sprintf("%d->%d", rate.ir, rate.or), func(t *testing.T) {
+			expected := new(bytes.Buffer)
+			res, err := resample.New(expected, resample.FormatInt16, rate.ir, rate.or, 2, resample.WithSingleStage())
+			require.NoError(t, err)
+			_, err = res.Write(data)
+			require.NoError(t, err)
+			require.NoError(t, res.Close())
+
+			output := new(bytes.Buffer)
+			res, err = resample.New(output, resample.FormatInt16, rate.ir, rate.or, 2, resample.WithRealtime())
+			require.NoError(t, err)
+			for i := 0; i < len(data); i += block {
+				_, err = res.Write(data[i:min(i+block, len(data))])
+				require.NoError(t, err)
+			}
+			require.NoError(t, res.Close())
+			assert.Equal(t, expected.Bytes(), output.Bytes())
+		})
+	}
+
+	t.Run("no allocations", func(t *testing.T) {
+		for _, rate := range rates {
+			for _, format := range []resample.Format{resample.FormatInt16, resample.FormatFloat32} {
+				res, err := resample.New(io.Discard, format, rate.ir, rate.or, 2, resample.WithRealtime())
+				require.NoError(t, err)
+				write := func() {
+					_, err = res.Write(data[:block])
+				}
+				for range 10 {
+					write()
+				}
+				assert.Zero(t, testing.AllocsPerRun(100, write), "%d->%d format %d", rate.ir, rate.or, format)
+				require.NoError(t, err)
+			}
+		}
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		for _, rate := range rates {
+			output := new(bytes.Buffer)
+			res, err := resample.New(output, resample.FormatInt16, rate.ir, rate.or, 2, resample.WithRealtime())
+			require.NoError(t, err)
+			inLatency, outLatency := res.Latency()
+			assert.Equal(t, resample.WingFrames(res), inLatency)
+			assert.Equal(t, (inLatency*rate.or+rate.ir-1)/rate.ir, outLatency)
+
+			frames := len(data) / 4
+			_, err = res.Write(data)
+			require.NoError(t, err)
+			written := output.Len() / 4
+			assert.Equal(t, ((frames-inLatency)*rate.or+rate.ir-1)/rate.ir, written, "%d->%d", rate.ir, rate.or)
+
+			require.NoError(t, res.Flush())
+			assert.LessOrEqual(t, output.Len()/4-written, outLatency)
+		}
+	})
+
+	t.Run("cascade latency", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		res, err := resample.New(output, resample.FormatInt16, 192000, 8000, 2)
+		require.NoError(t, err)
+		inLatency, outLatency := res.Latency()
+		assert.Greater(t, inLatency, resample.WingFrames(res))
+
+		frames := len(data) / 4
+		_, err = res.Write(data)
+		require.NoError(t, err)
+		written := output.Len() / 4
+		require.NoError(t, res.Flush())
+		// decimation stages may hold back a frame more
+		assert.LessOrEqual(t, output.Len()/4-written, outLatency+1)
+		assert.GreaterOrEqual(t, written, (frames-inLatency)/24-1)
+	})
+}
+
+func FuzzChunking(f *testing.F) {
+	sine := make([]int16, 1000)
+	for i := range sine {
+		sine[i] = int16(10000 * math.Sin(float64(i)/10))
+	}
+	data := buffer(f, sine).Bytes()
+	f.Add(data, uint16(1), uint8(1), uint8(2), uint8(1))
+	f.Add(data, uint16(7), uint8(3), uint8(2), uint8(1))
+	f.Add(data, uint16(100), uint8(44), uint8(147), uint8(2))
+	f.Add(data, uint16(333), uint8(160), uint8(48), uint8(5))
+
+	f.Fuzz(func(t *testing.T, data []byte, chunk uint16, ir, or, ch uint8) {
+		if ir == 0 || or == 0 || ch == 0 {
+			return
+		}
+		frameSize := formatElementSize[resample.FormatInt16] * int(ch)
+		data = data[:len(data)/frameSize*frameSize]
+		chunkSize := max(1, int(chunk))
+
+		whole := new(bytes.Buffer)
+		res, err := resample.New(whole, resample.FormatInt16, int(ir), int(or), int(ch),
+			resample.WithKaiserFastestFilter())
+		require.NoError(t, err)
+		_, err = res.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, res.Flush())
+
+		chunked := new(bytes.Buffer)
+		res, err = resample.New(chunked, resample.FormatInt16, int(ir), int(or), int(ch),
+			resample.WithKaiserFastestFilter())
+		require.NoError(t, err)
+		for len(data) > 0 {
+			n := min(chunkSize, len(data))
+			_, err = res.Write(data[:n])
+			require.NoError(t, err)
+			data = data[n:]
+		}
+		require.NoError(t, res.Flush())
+
+		assert.Equal(t, whole.Bytes(), chunked.Bytes())
+	})
 }
 
 func BenchmarkWrite(b *testing.B) {
@@ -280,12 +830,32 @@ func unBuffer[T any](t testing.TB, buff io.Reader) []T {
 	return output
 }
 
+// writeReference returns int16 samples of a given number of frames with a pseudo-random signal
+// and the reference output of resampling them with Write and Close.
+func writeReference(t testing.TB, frames, ir, or, ch int, options ...resample.Option) (data, expected []byte) {
+	t.Helper()
+	input := make([]int16, frames*ch)
+	for i := range input {
+		input[i] = int16(i*7919%20000 - 10000)
+	}
+	data = buffer(t, input).Bytes()
+
+	outBuf := new(bytes.Buffer)
+	res, err := resample.New(outBuf, resample.FormatInt16, ir, or, ch, options...)
+	require.NoError(t, err)
+	_, err = res.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, res.Close())
+	return data, outBuf.Bytes()
+}
+
 func Example_resamplingFile() {
 	input, _ := os.Open("./original.raw")
 	output, _ := os.Create("./resampled.raw")
 
 	res, _ := resample.New(output, resample.FormatInt16, 48000, 16000, 2)
 	_, _ = io.Copy(res, input)
+	_ = res.Close()
 }
 
 func Example_resamplingSlice() {
@@ -298,6 +868,7 @@ func Example_resamplingSlice() {
 	outBuf := new(bytes.Buffer)
 	res, _ := resample.New(outBuf, resample.FormatInt16, 1, 2, 1, resample.WithLinearFilter())
 	_, _ = res.Write(inputData.Bytes())
+	_ = res.Close()
 
 	// Convert bytes back to a slice of values
 	output := make([]int16, 5)
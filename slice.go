@@ -0,0 +1,107 @@
+package resample
+
+import (
+	"fmt"
+)
+
+// A SliceResampler is a struct used for resampling slices of samples
+// without encoding them into bytes.
+type SliceResampler[T number] struct {
+	c *convolver[T, T]
+}
+
+// NewSliceResampler creates a new SliceResampler.
+//
+// Samples of all channels are expected to be interleaved.
+// Options are the same as in New, except WithOutputFormat that is ignored.
+func NewSliceResampler[T number](inRate, outRate, ch int,
+	options ...Option) (*SliceResampler[T], error) {
+	// output buffer and formats are not used when resampling slices
+	r, err := New(nil, FormatFloat64, inRate, outRate, ch, options...)
+	if err != nil {
+		return nil, err
+	}
+	r.outFormat = r.format
+
+	c, err := newConvolver[T, T](r)
+	if err != nil {
+		return nil, err
+	}
+	return &SliceResampler[T]{c: c}, nil
+}
+
+// Resample appends src to the stream and appends resampled samples to dst.
+// It returns the extended dst slice.
+//
+// As with Resampler.Write, output samples that depend on input
+// that has not been received yet are held back until the next call or until Flush.
+// Length of src must be a multiple of the number of channels.
+func (s *SliceResampler[T]) Resample(dst, src []T) ([]T, error) {
+	if len(src)%s.c.r.ch != 0 {
+		return dst, fmt.Errorf("resampler: resample: %w", ErrMisalignedInput)
+	}
+
+	s.c.push(src)
+	return append(dst, s.c.process(s.c.ready())...), nil
+}
+
+// Flush ends the current stream and appends the remaining resampled samples to dst.
+// It returns the extended dst slice.
+//
+// After Flush the SliceResampler may be used to resample a new stream.
+func (s *SliceResampler[T]) Flush(dst []T) []T {
+	s.c.drain()
+	dst = append(dst, s.c.process(s.c.remaining())...)
+	s.c.reset()
+	return dst
+}
+
+// SetRates changes input and output rates of the current stream.
+// See Resampler.SetRates for details.
+func (s *SliceResampler[T]) SetRates(inRate, outRate int) error {
+	if err := s.c.r.SetRates(inRate, outRate); err != nil {
+		return err
+	}
+	s.c.retime()
+	return nil
+}
+
+// SetRatio changes the output rate of the current stream to inRate*ratio.
+// See Resampler.SetRatio for details.
+func (s *SliceResampler[T]) SetRatio(ratio float64) error {
+	if err := s.c.r.SetRatio(ratio); err != nil {
+		return err
+	}
+	s.c.retime()
+	return nil
+}
+
+// FilterMode returns a mode of evaluating filter values chosen during a NewSliceResampler call.
+func (s *SliceResampler[T]) FilterMode() FilterMode {
+	return s.c.r.FilterMode()
+}
+
+// Clipped returns the number of output samples that did not fit
+// into the range of an integer T and were saturated.
+func (s *SliceResampler[T]) Clipped() int64 {
+	return s.c.r.Clipped()
+}
+
+// ResampleSlice resamples src and appends the result to dst.
+// It returns the extended dst slice.
+//
+// Samples of all channels are expected to be interleaved.
+// Options are the same as in New.
+func ResampleSlice[T number](dst, src []T, inRate, outRate, ch int,
+	options ...Option) ([]T, error) {
+	s, err := NewSliceResampler[T](inRate, outRate, ch, options...)
+	if err != nil {
+		return dst, err
+	}
+
+	dst, err = s.Resample(dst, src)
+	if err != nil {
+		return dst, err
+	}
+	return s.Flush(dst), nil
+}
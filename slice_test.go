@@ -0,0 +1,167 @@
+package resample_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gunter-q12/resample"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestResampleSlice(t *testing.T) {
+	input := make([]float32, 3000)
+	for i := range input {
+		input[i] = float32(i%100) / 100
+	}
+
+	for _, chunk := range []int{1, 10, 3000} {
+		t.Run(fmt.Sprintf("chunks of %d", chunk), func(t *testing.T) {
+			expected := new(bytes.Buffer)
+			res, err := resample.New(expected, resample.FormatFloat32, 48000, 16000, 2)
+			require.NoError(t, err)
+			_, err = res.Write(buffer(t, input).Bytes())
+			require.NoError(t, err)
+			require.NoError(t, res.Close())
+
+			s, err := resample.NewSliceResampler[float32](48000, 16000, 2)
+			require.NoError(t, err)
+
+			var actual []float32
+			for start := 0; start < len(input); start += chunk * 2 {
+				end := min(start+chunk*2, len(input))
+				actual, err = s.Resample(actual, input[start:end])
+				require.NoError(t, err)
+			}
+			actual = s.Flush(actual)
+
+			assert.Equal(t, unBuffer[float32](t, expected), actual)
+		})
+	}
+}
+
+func TestResampleSliceErrors(t *testing.T) {
+	_, err := resample.ResampleSlice[int16](nil, []int16{1, 2, 3}, 1, 2, 2)
+	require.ErrorIs(t, err, resample.ErrMisalignedInput)
+
+	_, err = resample.ResampleSlice[int16](nil, []int16{1, 2}, 0, 2, 2)
+	require.ErrorIs(t, err, resample.ErrInvalidRate)
+}
+
+func Example_resamplingSliceDirectly() {
+	output, _ := resample.ResampleSlice(nil, []int16{1, 3, 5}, 1, 2, 1, resample.WithLinearFilter())
+
+	fmt.Println(output[:5])
+
+	// Output: [1 2 3 4 5]
+}
+
+func BenchmarkResampleSlice(b *testing.B) {
+	s, err := resample.NewSliceResampler[float64](8000, 44000, 2)
+	require.NoError(b, err)
+
+	file, err := os.Open("./testdata/bench_samples.raw")
+	if err != nil {
+		b.Fatal(err)
+	}
+	samples := unBuffer[float64](b, file)
+	samples = samples[:len(samples)/2*2]
+
+	var output []float64
+	b.ResetTimer()
+	for range b.N {
+		output, err = s.Resample(output[:0], samples)
+		require.NoError(b, err)
+		output = s.Flush(output)
+	}
+}
+
+func BenchmarkFilterModes(b *testing.B) {
+	file, err := os.Open("./testdata/bench_samples.raw")
+	if err != nil {
+		b.Fatal(err)
+	}
+	samples := unBuffer[float64](b, file)
+	samples = samples[:len(samples)/2*2]
+
+	modes := map[string]resample.Option{
+		"memoized":     {},
+		"quantized":    resample.WithQuantizedPhases(resample.DefaultQuantizedPhases),
+		"interpolated": resample.WithNoMemoization(),
+	}
+	for name, option := range modes {
+		b.Run(name, func(b *testing.B) {
+			s, err := resample.NewSliceResampler[float64](8000, 44000, 2, option)
+			require.NoError(b, err)
+
+			var output []float64
+			b.ResetTimer()
+			for range b.N {
+				output, err = s.Resample(output[:0], samples)
+				require.NoError(b, err)
+				output = s.Flush(output)
+			}
+		})
+	}
+}
+
+func BenchmarkMultiStage(b *testing.B) {
+	file, err := os.Open("./testdata/bench_samples.raw")
+	if err != nil {
+		b.Fatal(err)
+	}
+	samples := unBuffer[float64](b, file)
+	samples = samples[:len(samples)/2*2]
+
+	stages := map[string]resample.Option{
+		"multi":  {},
+		"single": resample.WithSingleStage(),
+	}
+	for name, option := range stages {
+		b.Run(name, func(b *testing.B) {
+			s, err := resample.NewSliceResampler[float64](192000, 8000, 2, option)
+			require.NoError(b, err)
+
+			var output []float64
+			b.ResetTimer()
+			for range b.N {
+				output, err = s.Resample(output[:0], samples)
+				require.NoError(b, err)
+				output = s.Flush(output)
+			}
+		})
+	}
+}
+
+func BenchmarkIntegerRatios(b *testing.B) {
+	file, err := os.Open("./testdata/bench_samples.raw")
+	if err != nil {
+		b.Fatal(err)
+	}
+	samples := unBuffer[float64](b, file)
+	samples = samples[:len(samples)/2*2]
+
+	rates := []struct{ ir, or int }{{48000, 16000}, {48000, 24000}, {16000, 32000}, {16000, 64000}, {8000, 48000}}
+	for _, rate := range rates {
+		for _, kernels := range []bool{true, false} {
+			name := fmt.Sprintf("%d->%d integer kernels %v", rate.ir, rate.or, kernels)
+			b.Run(name, func(b *testing.B) {
+				var options []resample.Option
+				if !kernels {
+					options = append(options, resample.WithGenericKernels())
+				}
+				s, err := resample.NewSliceResampler[float64](rate.ir, rate.or, 2, options...)
+				require.NoError(b, err)
+
+				var output []float64
+				b.ResetTimer()
+				for range b.N {
+					output, err = s.Resample(output[:0], samples)
+					require.NoError(b, err)
+					output = s.Flush(output)
+				}
+			})
+		}
+	}
+}